@@ -1,227 +1,136 @@
 package main
 
 import (
-	"context"
 	"fmt"
 	"os"
 	"testing"
-	"time"
-
-	"go.opentelemetry.io/collector/component/componenttest"
-	"go.opentelemetry.io/collector/config/configcompression"
-	"go.opentelemetry.io/collector/config/configoptional"
-	"go.opentelemetry.io/collector/config/configretry"
-	"go.opentelemetry.io/collector/config/configtls"
-	"go.opentelemetry.io/collector/exporter"
-	"go.opentelemetry.io/collector/exporter/exporterhelper"
-	"go.opentelemetry.io/collector/exporter/exportertest"
-	"go.opentelemetry.io/collector/exporter/otlpexporter"
-	"go.opentelemetry.io/collector/exporter/otlphttpexporter"
-
-	"github.com/open-telemetry/opentelemetry-collector-contrib/exporter/stefexporter"
 )
 
 var (
+	testSignal        signal
+	testCodecs        []codec
 	testPayloads      []payload
 	testTotalRawBytes int64
 	testGRPCServer    *grpcServer
 	testHTTPServer    *httpServer
 	testSTEFServer    *stefServer
+	testArrowServer   *arrowServer
 )
 
 func TestMain(m *testing.M) {
-	dir := os.Getenv("EXPORTBENCH_INPUT_DIR")
-	if dir == "" {
-		fmt.Fprintln(os.Stderr, "EXPORTBENCH_INPUT_DIR not set, skipping benchmarks")
-		os.Exit(0)
+	sigName := os.Getenv("EXPORTBENCH_SIGNAL")
+	if sigName == "" {
+		sigName = string(signalAuto)
+	}
+	sig, err := parseSignal(sigName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid EXPORTBENCH_SIGNAL: %v\n", err)
+		os.Exit(1)
 	}
 
-	var err error
-	testPayloads, testTotalRawBytes, err = loadPayloads(dir)
+	if dir := os.Getenv("EXPORTBENCH_INPUT_DIR"); dir != "" {
+		testPayloads, testTotalRawBytes, err = loadPayloads(dir, sig)
+	} else {
+		// Fall back to a deterministic synthetic dataset so the benchmarks
+		// always have data.
+		if sig == signalAuto {
+			sig = signalMetrics
+		}
+		testPayloads, testTotalRawBytes, err = generatePayloads(defaultSyntheticConfig(), sig)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to load payloads: %v\n", err)
 		os.Exit(1)
 	}
+	testSignal = testPayloads[0].signal
 
-	testGRPCServer, err = startGRPCServer()
+	codecList := os.Getenv("EXPORTBENCH_CODECS")
+	if codecList == "" {
+		codecList = defaultCodecs
+	}
+	testCodecs, err = parseCodecs(codecList)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid EXPORTBENCH_CODECS: %v\n", err)
+		os.Exit(1)
+	}
+
+	// EXPORTBENCH_DECODE=1 makes the servers decode every request, so that
+	// ns/op and allocs/op include the receiving side.
+	srvOpts := serverOptions{decode: os.Getenv("EXPORTBENCH_DECODE") == "1"}
+
+	testGRPCServer, err = startGRPCServer(srvOpts)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to start gRPC server: %v\n", err)
 		os.Exit(1)
 	}
 
-	testHTTPServer, err = startHTTPServer()
+	testHTTPServer, err = startHTTPServer(srvOpts)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to start HTTP server: %v\n", err)
 		os.Exit(1)
 	}
 
-	testSTEFServer, err = startSTEFServer()
+	testSTEFServer, err = startSTEFServer(srvOpts)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to start STEF server: %v\n", err)
 		os.Exit(1)
 	}
 
+	testArrowServer, err = startArrowServer(srvOpts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to start OTel Arrow server: %v\n", err)
+		os.Exit(1)
+	}
+
 	code := m.Run()
 
 	testGRPCServer.Stop()
 	testHTTPServer.Stop()
 	testSTEFServer.Stop()
+	testArrowServer.Stop()
 
 	os.Exit(code)
 }
 
-func benchmarkExporter(b *testing.B, exp exporter.Metrics, counter *bytesCounter) {
-	b.Helper()
-	b.SetBytes(testTotalRawBytes)
-	b.ReportAllocs()
-	ctx := context.Background()
-
-	// Warmup and discard initial bytes.
-	for _, p := range testPayloads {
-		if err := exp.ConsumeMetrics(ctx, p.req.Metrics()); err != nil {
-			b.Fatal(err)
-		}
-	}
-	counter.ReadAndReset()
-
-	for b.Loop() {
-		for _, p := range testPayloads {
-			if err := exp.ConsumeMetrics(ctx, p.req.Metrics()); err != nil {
-				b.Fatal(err)
-			}
-		}
-	}
-
-	wireBytes := counter.ReadAndReset()
-	if b.N > 0 {
-		bytesPerOp := float64(wireBytes) / float64(b.N)
-		ratio := float64(testTotalRawBytes) / bytesPerOp
-		b.ReportMetric(bytesPerOp, "wire-B/op")
-		b.ReportMetric(ratio, "compress-ratio")
-	}
-}
-
-func newGRPCExporter(b *testing.B, compression configcompression.Type) exporter.Metrics {
-	b.Helper()
-	factory := otlpexporter.NewFactory()
-	cfg := factory.CreateDefaultConfig().(*otlpexporter.Config)
-	cfg.ClientConfig.Endpoint = testGRPCServer.Endpoint()
-	cfg.ClientConfig.TLS = configtls.ClientConfig{Insecure: true}
-	cfg.ClientConfig.Compression = compression
-	cfg.RetryConfig = configretry.BackOffConfig{Enabled: false}
-	cfg.QueueConfig = configoptional.None[exporterhelper.QueueBatchConfig]()
-
-	ctx := context.Background()
-	exp, err := factory.CreateMetrics(ctx, exportertest.NewNopSettings(factory.Type()), cfg)
-	if err != nil {
-		b.Fatal(err)
+// BenchmarkExport runs one sub-benchmark per format of the built-in matrix,
+// named by formatKey, e.g. BenchmarkExport/OTLP_gRPC_zstd.
+func BenchmarkExport(b *testing.B) {
+	for _, f := range buildFormats(testSignal, testCodecs, testNopServers(), queueMode{}) {
+		b.Run(formatKey(f.name), func(b *testing.B) {
+			benchmarkFormat(b, f)
+		})
 	}
-	if err := exp.Start(ctx, componenttest.NewNopHost()); err != nil {
-		b.Fatal(err)
-	}
-	b.Cleanup(func() { exp.Shutdown(ctx) })
-	return exp
 }
 
-func newHTTPExporter(b *testing.B, encoding otlphttpexporter.EncodingType, compression configcompression.Type) exporter.Metrics {
+// benchmarkFormat warms the exporter up and sizes one export of its own
+// before the timed loop, as the CLI does, so wire-B/op does not depend on
+// b.N and the sizing pass does not count towards allocs/op.
+func benchmarkFormat(b *testing.B, f benchFormat) {
 	b.Helper()
-	factory := otlphttpexporter.NewFactory()
-	cfg := factory.CreateDefaultConfig().(*otlphttpexporter.Config)
-	cfg.ClientConfig.Endpoint = testHTTPServer.Endpoint()
-	cfg.ClientConfig.Compression = compression
-	cfg.Encoding = encoding
-	cfg.RetryConfig = configretry.BackOffConfig{Enabled: false}
-	cfg.QueueConfig = configoptional.None[exporterhelper.QueueBatchConfig]()
-
-	ctx := context.Background()
-	exp, err := factory.CreateMetrics(ctx, exportertest.NewNopSettings(factory.Type()), cfg)
-	if err != nil {
-		b.Fatal(err)
-	}
-	if err := exp.Start(ctx, componenttest.NewNopHost()); err != nil {
+	if err := f.setup(); err != nil {
 		b.Fatal(err)
 	}
-	b.Cleanup(func() { exp.Shutdown(ctx) })
-	return exp
-}
-
-func BenchmarkOTLPgRPC(b *testing.B) {
-	if len(testPayloads) == 0 {
-		b.Skip("no test payloads")
-	}
-	benchmarkExporter(b, newGRPCExporter(b, ""), testGRPCServer.Counter)
-}
+	b.Cleanup(f.cleanup)
 
-func BenchmarkOTLPgRPC_Zstd(b *testing.B) {
-	if len(testPayloads) == 0 {
-		b.Skip("no test payloads")
-	}
-	benchmarkExporter(b, newGRPCExporter(b, configcompression.TypeZstd), testGRPCServer.Counter)
-}
-
-func BenchmarkOTLPHTTP_Proto(b *testing.B) {
-	if len(testPayloads) == 0 {
-		b.Skip("no test payloads")
-	}
-	benchmarkExporter(b, newHTTPExporter(b, otlphttpexporter.EncodingProto, ""), testHTTPServer.Counter)
-}
-
-func BenchmarkOTLPHTTP_Proto_Zstd(b *testing.B) {
-	if len(testPayloads) == 0 {
-		b.Skip("no test payloads")
-	}
-	benchmarkExporter(b, newHTTPExporter(b, otlphttpexporter.EncodingProto, configcompression.TypeZstd), testHTTPServer.Counter)
-}
-
-func BenchmarkOTLPHTTP_JSON(b *testing.B) {
-	if len(testPayloads) == 0 {
-		b.Skip("no test payloads")
-	}
-	benchmarkExporter(b, newHTTPExporter(b, otlphttpexporter.EncodingJSON, ""), testHTTPServer.Counter)
-}
-
-func BenchmarkOTLPHTTP_JSON_Zstd(b *testing.B) {
-	if len(testPayloads) == 0 {
-		b.Skip("no test payloads")
-	}
-	benchmarkExporter(b, newHTTPExporter(b, otlphttpexporter.EncodingJSON, configcompression.TypeZstd), testHTTPServer.Counter)
-}
-
-func newSTEFExporter(b *testing.B, compression configcompression.Type) exporter.Metrics {
-	b.Helper()
-	factory := stefexporter.NewFactory()
-	cfg := factory.CreateDefaultConfig().(*stefexporter.Config)
-	cfg.ClientConfig.Endpoint = testSTEFServer.Endpoint()
-	cfg.ClientConfig.TLS = configtls.ClientConfig{Insecure: true}
-	cfg.ClientConfig.Compression = compression
-	cfg.TimeoutConfig = exporterhelper.TimeoutConfig{Timeout: 2 * time.Minute}
-	cfg.RetryConfig = configretry.BackOffConfig{Enabled: false}
-	qCfg := exporterhelper.NewDefaultQueueConfig()
-	qCfg.QueueSize = 50000
-	cfg.QueueConfig = configoptional.Some(qCfg)
-
-	ctx := context.Background()
-	exp, err := factory.CreateMetrics(ctx, exportertest.NewNopSettings(factory.Type()), cfg)
-	if err != nil {
+	if err := f.export(testPayloads); err != nil {
 		b.Fatal(err)
 	}
-	if err := exp.Start(ctx, componenttest.NewNopHost()); err != nil {
+	f.size() // discard warmup bytes
+	if err := f.export(testPayloads); err != nil {
 		b.Fatal(err)
 	}
-	b.Cleanup(func() { exp.Shutdown(ctx) })
-	return exp
-}
+	wireBytes := f.size()
 
-func BenchmarkSTEF(b *testing.B) {
-	if len(testPayloads) == 0 {
-		b.Skip("no test payloads")
+	b.SetBytes(testTotalRawBytes)
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := f.export(testPayloads); err != nil {
+			b.Fatal(err)
+		}
 	}
-	benchmarkExporter(b, newSTEFExporter(b, ""), testSTEFServer.Counter)
-}
 
-func BenchmarkSTEF_Zstd(b *testing.B) {
-	if len(testPayloads) == 0 {
-		b.Skip("no test payloads")
+	b.ReportMetric(float64(wireBytes), "wire-B/op")
+	if wireBytes > 0 {
+		b.ReportMetric(float64(testTotalRawBytes)/float64(wireBytes), "compress-ratio")
 	}
-	benchmarkExporter(b, newSTEFExporter(b, configcompression.TypeZstd), testSTEFServer.Counter)
 }
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	ossignal "os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// recorder writes captured requests to a payload directory as NNNN.pb, in
+// the layout generate writes and --input-dir reads. A directory holds one
+// signal: with signalAuto it is the signal of the first request, and
+// requests of other signals are acknowledged but skipped.
+type recorder struct {
+	dir         string
+	maxRequests int
+	maxBytes    int64
+	// done is closed once a limit is reached or a write fails.
+	done chan struct{}
+
+	mu       sync.Mutex
+	sig      signal
+	requests int
+	bytes    int64
+	items    int
+	skipped  int
+	err      error
+}
+
+func newRecorder(dir string, sig signal, maxRequests int, maxBytes int64) *recorder {
+	return &recorder{
+		dir:         dir,
+		sig:         sig,
+		maxRequests: maxRequests,
+		maxBytes:    maxBytes,
+		done:        make(chan struct{}),
+	}
+}
+
+// full reports whether a limit is reached or writing failed. It must be
+// called with mu held.
+func (r *recorder) full() bool {
+	return r.err != nil ||
+		(r.maxRequests > 0 && r.requests >= r.maxRequests) ||
+		(r.maxBytes > 0 && r.bytes >= r.maxBytes)
+}
+
+// record writes p as the next payload file. Requests received over OTLP
+// JSON are written as protobuf. The request that reaches a limit is still
+// written; later ones are not.
+func (r *recorder) record(p payload) {
+	raw := p.raw
+	if raw == nil {
+		var err error
+		if raw, err = p.marshalProto(); err != nil {
+			r.fail(fmt.Errorf("marshaling %s request: %w", p.signal, err))
+			return
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.full() {
+		return
+	}
+	if r.sig == signalAuto {
+		r.sig = p.signal
+	}
+	if p.signal != r.sig {
+		r.skipped++
+		return
+	}
+	name := filepath.Join(r.dir, fmt.Sprintf("%04d.pb", r.requests))
+	if err := os.WriteFile(name, raw, 0o644); err != nil {
+		r.err = err
+		close(r.done)
+		return
+	}
+	r.requests++
+	r.bytes += int64(len(raw))
+	r.items += p.itemCount()
+	if r.full() {
+		close(r.done)
+	}
+}
+
+func (r *recorder) fail(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.full() {
+		return
+	}
+	r.err = err
+	close(r.done)
+}
+
+// checkEmptyDir refuses to capture into a directory that already holds
+// payloads, which would mix two recordings into one dataset.
+func checkEmptyDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, e := range entries {
+		if !e.IsDir() && isInputFile(e.Name()) {
+			return fmt.Errorf("%s already contains payloads (%s)", dir, e.Name())
+		}
+	}
+	return nil
+}
+
+func runCapture(args []string) error {
+	fs := flag.NewFlagSet("capture", flag.ExitOnError)
+	outputDir := fs.String("output-dir", "", "directory to write .pb files to (required)")
+	grpcAddr := fs.String("grpc-endpoint", "localhost:4317", "address of the OTLP gRPC receiver, empty to disable")
+	httpAddr := fs.String("http-endpoint", "localhost:4318", "address of the OTLP HTTP receiver, empty to disable")
+	signalName := fs.String("signal", string(signalAuto), "signal to record: auto (the first one received), metrics, logs, traces or profiles")
+	maxRequests := fs.Int("max-requests", 100, "stop after this many requests, 0 for no limit")
+	maxSize := fs.String("max-size", "0", "stop once the payloads reach this size, e.g. 64MiB; 0 for no limit")
+	fs.Parse(args)
+
+	if *outputDir == "" {
+		fs.Usage()
+		return errors.New("--output-dir is required")
+	}
+	if *grpcAddr == "" && *httpAddr == "" {
+		return errors.New("--grpc-endpoint and --http-endpoint cannot both be empty")
+	}
+	sig, err := parseSignal(*signalName)
+	if err != nil {
+		return err
+	}
+	maxBytes, err := parseByteSize(*maxSize)
+	if err != nil {
+		return fmt.Errorf("invalid --max-size: %w", err)
+	}
+	if err := checkEmptyDir(*outputDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*outputDir, 0o755); err != nil {
+		return err
+	}
+
+	rec := newRecorder(*outputDir, sig, *maxRequests, maxBytes)
+	sink := &captureSink{record: rec.record}
+	sink.start()
+	// The servers decode every request, which is how they hand pdata to
+	// the sink.
+	opts := serverOptions{decode: true, capture: sink}
+	if *grpcAddr != "" {
+		opts.addr = *grpcAddr
+		srv, err := startGRPCServer(opts)
+		if err != nil {
+			return fmt.Errorf("OTLP gRPC receiver: %w", err)
+		}
+		defer srv.Stop()
+		fmt.Fprintf(os.Stderr, "OTLP gRPC receiver listening on %s\n", srv.Endpoint())
+	}
+	if *httpAddr != "" {
+		opts.addr = *httpAddr
+		srv, err := startHTTPServer(opts)
+		if err != nil {
+			return fmt.Errorf("OTLP HTTP receiver: %w", err)
+		}
+		defer srv.Stop()
+		fmt.Fprintf(os.Stderr, "OTLP HTTP receiver listening on %s\n", srv.Endpoint())
+	}
+
+	ctx, stop := ossignal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	select {
+	case <-rec.done:
+	case <-ctx.Done():
+		fmt.Fprintln(os.Stderr, "interrupted")
+	}
+	sink.stop()
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.err != nil {
+		return rec.err
+	}
+	if rec.requests == 0 {
+		return errors.New("no requests captured")
+	}
+	fmt.Fprintf(os.Stderr, "wrote %d %s payloads (%d %s, %.1f MB) to %s\n",
+		rec.requests, rec.sig, rec.items, rec.sig.itemName(), float64(rec.bytes)/1024/1024, *outputDir)
+	if rec.skipped > 0 {
+		fmt.Fprintf(os.Stderr, "skipped %d requests of other signals\n", rec.skipped)
+	}
+	return nil
+}
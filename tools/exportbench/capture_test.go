@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/exporter/otlphttpexporter"
+)
+
+func TestCapture(t *testing.T) {
+	dir := t.TempDir()
+	rec := newRecorder(dir, signalAuto, len(testPayloads), 0)
+	sink := &captureSink{record: rec.record}
+	sink.start()
+	opts := serverOptions{decode: true, capture: sink}
+	grpcSrv, err := startGRPCServer(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer grpcSrv.Stop()
+	httpSrv, err := startHTTPServer(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer httpSrv.Stop()
+
+	// JSON over HTTP is recorded as protobuf, byte for byte what was sent.
+	f := newHTTPFormat("capture", testSignal, httpSrv, otlphttpexporter.EncodingJSON, codec{}, queueMode{})
+	if err := f.setup(); err != nil {
+		t.Fatal(err)
+	}
+	defer f.cleanup()
+	if err := f.export(testPayloads); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-rec.done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("max-requests not reached")
+	}
+
+	// Past the limit requests are still acknowledged, but not written.
+	g := newGRPCFormat("capture", testSignal, grpcSrv, codec{}, queueMode{})
+	if err := g.setup(); err != nil {
+		t.Fatal(err)
+	}
+	defer g.cleanup()
+	if err := g.export(testPayloads[:1]); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _, err := loadPayloads(dir, signalAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(testPayloads) {
+		t.Fatalf("captured %d payloads, want %d", len(got), len(testPayloads))
+	}
+	for i, p := range got {
+		if !bytes.Equal(p.raw, testPayloads[i].raw) {
+			t.Errorf("%s differs from %s", p.filename, testPayloads[i].filename)
+		}
+	}
+	if err := checkEmptyDir(dir); err == nil {
+		t.Error("capturing into a used directory was allowed")
+	}
+	if err := checkEmptyDir(dir + "/new"); err != nil {
+		t.Error(err)
+	}
+}
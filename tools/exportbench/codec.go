@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/collector/config/configcompression"
+)
+
+// codec is one entry of --codecs: a compression type and an optional level.
+type codec struct {
+	typ   configcompression.Type
+	level configcompression.Level
+}
+
+// defaultCodecs keeps the historical matrix of uncompressed and zstd.
+const defaultCodecs = "none,zstd"
+
+// parseCodecs parses a comma-separated list of codec[:level] entries, such as
+// "none,gzip:9,zstd:3".
+func parseCodecs(s string) ([]codec, error) {
+	var codecs []codec
+	seen := map[codec]bool{}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, levelStr, hasLevel := strings.Cut(entry, ":")
+		c := codec{typ: configcompression.Type(name)}
+		if name == "none" {
+			c.typ = ""
+		}
+		if err := c.typ.UnmarshalText([]byte(c.typ)); err != nil {
+			return nil, fmt.Errorf("codec %q: %w", entry, err)
+		}
+		if hasLevel {
+			if !c.typ.IsCompressed() {
+				return nil, fmt.Errorf("codec %q: no compression has no level", entry)
+			}
+			level, err := strconv.Atoi(levelStr)
+			if err != nil {
+				return nil, fmt.Errorf("codec %q: invalid level: %w", entry, err)
+			}
+			c.level = configcompression.Level(level)
+			if err := c.typ.ValidateParams(configcompression.CompressionParams{Level: c.level}); err != nil {
+				return nil, fmt.Errorf("codec %q: %w", entry, err)
+			}
+		}
+		if seen[c] {
+			continue
+		}
+		seen[c] = true
+		codecs = append(codecs, c)
+	}
+	if len(codecs) == 0 {
+		return nil, fmt.Errorf("no codecs in %q", s)
+	}
+	return codecs, nil
+}
+
+// String returns the codec in --codecs syntax.
+func (c codec) String() string {
+	switch {
+	case !c.typ.IsCompressed():
+		return "none"
+	case c.level != 0:
+		return fmt.Sprintf("%s:%d", c.typ, c.level)
+	default:
+		return string(c.typ)
+	}
+}
+
+// grpcSupported reports whether configgrpc can send with this codec. gRPC
+// registers gzip, snappy and zstd compressors only, and has no levels.
+func (c codec) grpcSupported() bool {
+	switch c.typ {
+	case "", configcompression.TypeGzip, configcompression.TypeSnappy, configcompression.TypeZstd:
+		return c.level == 0
+	}
+	return false
+}
+
+// stefSupported reports whether the STEF exporter can send with this codec.
+func (c codec) stefSupported() bool {
+	return (c.typ == "" || c.typ == configcompression.TypeZstd) && c.level == 0
+}
+
+func (c codec) params() configcompression.CompressionParams {
+	return configcompression.CompressionParams{Level: c.level}
+}
+
+// formatName appends the codec to a transport name the way the original
+// matrix did: "OTLP gRPC + zstd", "OTLP HTTP proto+gzip:9", "STEF (zstd)".
+func (c codec) formatName(base, sep string) string {
+	if !c.typ.IsCompressed() {
+		return base
+	}
+	return base + sep + c.String()
+}
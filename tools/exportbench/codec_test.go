@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"go.opentelemetry.io/collector/config/configcompression"
+)
+
+func TestParseCodecs(t *testing.T) {
+	codecs, err := parseCodecs("none, gzip:9,zstd,zstd:3,snappy,zstd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"none", "gzip:9", "zstd", "zstd:3", "snappy"}
+	if len(codecs) != len(want) {
+		t.Fatalf("got %d codecs, want %d", len(codecs), len(want))
+	}
+	for i, c := range codecs {
+		if c.String() != want[i] {
+			t.Errorf("codec %d = %s, want %s", i, c, want[i])
+		}
+	}
+
+	if got := codecs[1]; got.typ != configcompression.TypeGzip || got.level != 9 {
+		t.Errorf("gzip:9 parsed as %+v", got)
+	}
+	if !codecs[2].grpcSupported() || codecs[3].grpcSupported() {
+		t.Error("gRPC supports zstd but not zstd levels")
+	}
+	if codecs[1].stefSupported() || !codecs[0].stefSupported() {
+		t.Error("STEF supports none and zstd only")
+	}
+	if name := codecs[3].formatName("OTLP HTTP proto", "+"); name != "OTLP HTTP proto+zstd:3" {
+		t.Errorf("formatName = %q", name)
+	}
+
+	for _, bad := range []string{"brotli", "gzip:42", "none:1", "zstd:x", ""} {
+		if _, err := parseCodecs(bad); err == nil {
+			t.Errorf("parseCodecs(%q) succeeded, want error", bad)
+		}
+	}
+}
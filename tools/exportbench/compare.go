@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// compareMetric is a resultRecord field that compare can diff and gate on.
+// All of them are lower-is-better.
+type compareMetric struct {
+	name  string
+	value func(resultRecord) float64
+	show  func(float64) string
+	// perIteration extracts the metric from a single timed iteration. It is
+	// nil for metrics that do not vary between iterations.
+	perIteration func(iterationRecord) float64
+}
+
+var compareMetrics = []compareMetric{
+	{
+		name:  "size",
+		value: func(r resultRecord) float64 { return float64(r.TotalBytes) },
+		show:  func(v float64) string { return fmt.Sprintf("%.2f MB", v/1024/1024) },
+	},
+	{
+		name:  "time",
+		value: func(r resultRecord) float64 { return float64(r.SerializeTimeNs) },
+		show:  func(v float64) string { return time.Duration(v).Round(time.Microsecond).String() },
+
+		perIteration: func(r iterationRecord) float64 { return float64(r.ElapsedNs) },
+	},
+	{
+		name:  "cpu",
+		value: func(r resultRecord) float64 { return float64(r.CPUTimeNs) },
+		show:  func(v float64) string { return time.Duration(v).Round(time.Microsecond).String() },
+
+		perIteration: func(r iterationRecord) float64 { return float64(r.CPUNs) },
+	},
+	{
+		name:  "allocs",
+		value: func(r resultRecord) float64 { return float64(r.NumAllocs) },
+		show:  func(v float64) string { return fmt.Sprintf("%.0f", v) },
+
+		perIteration: func(r iterationRecord) float64 { return float64(r.Allocs) },
+	},
+	{
+		name:  "bytes",
+		value: func(r resultRecord) float64 { return float64(r.AllocBytes) },
+		show:  func(v float64) string { return fmt.Sprintf("%.2f MB", v/1024/1024) },
+
+		perIteration: func(r iterationRecord) float64 { return float64(r.AllocBytes) },
+	},
+}
+
+// comparison is the delta of one metric for one format.
+type comparison struct {
+	format    string
+	metric    compareMetric
+	baseline  []float64
+	candidate []float64
+	deltaPct  float64
+	p         float64
+	hasP      bool
+}
+
+// significant reports whether the delta passes the significance level. A
+// comparison without a p-value (single runs) is treated as significant, so
+// gating still works on plain threshold checks.
+func (c comparison) significant(alpha float64) bool {
+	return !c.hasP || c.p < alpha
+}
+
+// readReports decodes every report in a results file. Appending several runs
+// to one file (--output-format json >> runs.json) yields a stream of reports,
+// which compare treats as repeated samples.
+func readReports(path string) ([]report, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var reports []report
+	dec := json.NewDecoder(f)
+	for {
+		var r report
+		if err := dec.Decode(&r); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("decoding %s: %w", path, err)
+		}
+		reports = append(reports, r)
+	}
+	if len(reports) == 0 {
+		return nil, fmt.Errorf("no results in %s", path)
+	}
+	return reports, nil
+}
+
+// samples collects the metric value of a format across runs. With
+// perIteration, metrics that vary between iterations contribute every
+// iteration's value instead.
+func samples(reports []report, format string, m compareMetric, perIteration bool) []float64 {
+	var out []float64
+	for _, r := range reports {
+		for _, res := range r.Results {
+			if res.Format != format {
+				continue
+			}
+			if perIteration && m.perIteration != nil {
+				for _, s := range res.Samples {
+					out = append(out, m.perIteration(s))
+				}
+				continue
+			}
+			out = append(out, m.value(res))
+		}
+	}
+	return out
+}
+
+// perIterationSamples reports whether a format is compared over
+// per-iteration samples, so that one results file per side is still enough
+// for a significance test. Both sides must then be a single run with
+// samples: iteration values vary more than run means, and the t-test needs
+// both sides to be samples of the same kind.
+func perIterationSamples(baseline, candidate []report, format string) bool {
+	return len(baseline) == 1 && len(candidate) == 1 &&
+		hasIterationSamples(baseline[0], format) && hasIterationSamples(candidate[0], format)
+}
+
+func hasIterationSamples(r report, format string) bool {
+	for _, res := range r.Results {
+		if res.Format == format {
+			return len(res.Samples) > 0
+		}
+	}
+	return false
+}
+
+func compareReports(baseline, candidate []report) []comparison {
+	var comparisons []comparison
+	for _, res := range baseline[0].Results {
+		perIteration := perIterationSamples(baseline, candidate, res.Format)
+		for _, m := range compareMetrics {
+			base := samples(baseline, res.Format, m, perIteration)
+			cand := samples(candidate, res.Format, m, perIteration)
+			if len(cand) == 0 {
+				continue
+			}
+			c := comparison{format: res.Format, metric: m, baseline: base, candidate: cand}
+			if bm := mean(base); bm != 0 {
+				c.deltaPct = (mean(cand) - bm) / bm * 100
+			}
+			c.p, c.hasP = welchTTest(base, cand)
+			comparisons = append(comparisons, c)
+		}
+	}
+	return comparisons
+}
+
+// runCompare implements the compare subcommand. It returns errRegression
+// when the gated metric regresses past the threshold.
+func runCompare(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	metricName := fs.String("metric", "time", "metric to gate on: size, time, cpu, allocs, bytes or all")
+	threshold := fs.Float64("threshold", 5, "maximum allowed regression in percent")
+	alpha := fs.Float64("alpha", 0.05, "significance level for the Welch t-test")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: exportbench compare [flags] baseline.json candidate.json\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("compare needs a baseline and a candidate results file")
+	}
+	gated := map[string]bool{}
+	for _, m := range compareMetrics {
+		if *metricName == "all" || *metricName == m.name {
+			gated[m.name] = true
+		}
+	}
+	if len(gated) == 0 {
+		return fmt.Errorf("unknown --metric %q", *metricName)
+	}
+
+	baseline, err := readReports(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	candidate, err := readReports(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	if b, c := baseline[0].Dataset, candidate[0].Dataset; b != c {
+		fmt.Fprintf(os.Stderr, "warning: datasets differ (%s, %d files vs %s, %d files)\n",
+			b.Source, b.Files, c.Source, c.Files)
+	}
+
+	comparisons := compareReports(baseline, candidate)
+
+	fmt.Printf("## Comparison (%d baseline vs %d candidate runs)\n\n", len(baseline), len(candidate))
+	fmt.Println("| Format | Metric | Baseline | Candidate | Delta | p-value |")
+	fmt.Println("|--------|--------|----------|-----------|-------|---------|")
+	var regressions []comparison
+	for _, c := range comparisons {
+		p := "n/a"
+		if c.hasP {
+			p = fmt.Sprintf("%.3f", c.p)
+		}
+		delta := fmt.Sprintf("%+.2f%%", c.deltaPct)
+		if gated[c.metric.name] && c.deltaPct > *threshold && c.significant(*alpha) {
+			regressions = append(regressions, c)
+			delta = "**" + delta + "**"
+		}
+		fmt.Printf("| %-22s | %-6s | %12s | %12s | %9s | %7s |\n",
+			c.format,
+			c.metric.name,
+			c.metric.show(mean(c.baseline)),
+			c.metric.show(mean(c.candidate)),
+			delta,
+			p,
+		)
+	}
+	for _, res := range baseline[0].Results {
+		if len(samples(candidate, res.Format, compareMetrics[0], false)) == 0 {
+			fmt.Fprintf(os.Stderr, "warning: %s missing from candidate results\n", res.Format)
+		}
+	}
+
+	if len(regressions) > 0 {
+		fmt.Println()
+		for _, c := range regressions {
+			fmt.Printf("- REGRESSION: %s %s %+.2f%% (threshold %.2f%%)\n", c.format, c.metric.name, c.deltaPct, *threshold)
+		}
+		return errRegression
+	}
+	return nil
+}
+
+var errRegression = errors.New("regression detected")
+
+// Exit codes of the compare subcommand. As with diff, 1 means the
+// candidate regressed and 2 that the comparison could not be made, the
+// code flag parsing errors exit with too, so CI can tell them apart.
+const (
+	exitRegression   = 1
+	exitCompareError = 2
+)
+
+func compareExitCode(err error) int {
+	if errors.Is(err, errRegression) {
+		return exitRegression
+	}
+	return exitCompareError
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCompareReports(t *testing.T) {
+	run := func(size int64, ns int64) report {
+		return report{Results: []resultRecord{{Format: "A", TotalBytes: size, SerializeTimeNs: ns}}}
+	}
+	baseline := []report{run(100, 1000), run(100, 1010), run(100, 990)}
+	candidate := []report{run(100, 1200), run(100, 1210), run(100, 1190)}
+
+	byMetric := map[string]comparison{}
+	for _, c := range compareReports(baseline, candidate) {
+		byMetric[c.metric.name] = c
+	}
+
+	timeCmp := byMetric["time"]
+	if timeCmp.deltaPct < 19.9 || timeCmp.deltaPct > 20.1 {
+		t.Errorf("time delta = %.2f%%, want 20%%", timeCmp.deltaPct)
+	}
+	if !timeCmp.significant(0.05) {
+		t.Errorf("time delta should be significant, p = %v", timeCmp.p)
+	}
+
+	sizeCmp := byMetric["size"]
+	if sizeCmp.deltaPct != 0 || sizeCmp.significant(0.05) {
+		t.Errorf("unexpected size comparison: %+v", sizeCmp)
+	}
+}
+
+func TestCompareExitCode(t *testing.T) {
+	if got := compareExitCode(errRegression); got != exitRegression {
+		t.Errorf("exit code for a regression = %d, want %d", got, exitRegression)
+	}
+	_, err := readReports(filepath.Join(t.TempDir(), "missing.json"))
+	if err == nil {
+		t.Fatal("readReports accepted a missing file")
+	}
+	if got := compareExitCode(err); got != exitCompareError {
+		t.Errorf("exit code for %v = %d, want %d", err, got, exitCompareError)
+	}
+}
+
+func TestCompareReportsMatchesSampleKinds(t *testing.T) {
+	run := func(ns ...int64) report {
+		res := resultRecord{Format: "A", SerializeTimeNs: ns[0]}
+		for _, n := range ns {
+			res.Samples = append(res.Samples, iterationRecord{ElapsedNs: n})
+		}
+		return report{Results: []resultRecord{res}}
+	}
+	timeComparison := func(baseline, candidate []report) comparison {
+		for _, c := range compareReports(baseline, candidate) {
+			if c.metric.name == "time" {
+				return c
+			}
+		}
+		t.Fatal("no time comparison")
+		return comparison{}
+	}
+
+	// Two single runs compare their iterations.
+	c := timeComparison([]report{run(1000, 1010, 990)}, []report{run(1200, 1210, 1190)})
+	if len(c.baseline) != 3 || len(c.candidate) != 3 {
+		t.Errorf("single runs: %d vs %d samples, want 3 vs 3", len(c.baseline), len(c.candidate))
+	}
+
+	// A single run against several compares run values on both sides.
+	c = timeComparison([]report{run(1000, 1010, 990)}, []report{run(1200, 1210), run(1190, 1200)})
+	if len(c.baseline) != 1 || len(c.candidate) != 2 {
+		t.Errorf("single vs repeated runs: %d vs %d samples, want 1 vs 2", len(c.baseline), len(c.candidate))
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import "sync"
+
+// shardPayloads deals payloads round-robin into n shards so that every
+// goroutine gets a similar mix of payload sizes.
+func shardPayloads(payloads []payload, n int) [][]payload {
+	shards := make([][]payload, 0, n)
+	for i := 0; i < n && i < len(payloads); i++ {
+		var shard []payload
+		for j := i; j < len(payloads); j += n {
+			shard = append(shard, payloads[j])
+		}
+		shards = append(shards, shard)
+	}
+	return shards
+}
+
+// exportShards runs export once per shard, all shards in parallel against the
+// same exporter, mirroring exporterhelper's sending_queue consumers. It
+// returns the first error.
+func exportShards(export func([]payload) error, shards [][]payload) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(shards))
+	for i, shard := range shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = export(shard)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
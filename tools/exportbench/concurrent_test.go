@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestShardPayloads(t *testing.T) {
+	payloads := make([]payload, 7)
+	for i := range payloads {
+		payloads[i].filename = string(rune('a' + i))
+	}
+
+	shards := shardPayloads(payloads, 3)
+	if len(shards) != 3 {
+		t.Fatalf("got %d shards, want 3", len(shards))
+	}
+	got := ""
+	for _, shard := range shards {
+		for _, p := range shard {
+			got += p.filename
+		}
+		got += "|"
+	}
+	if got != "adg|be|cf|" {
+		t.Errorf("shards = %s, want adg|be|cf|", got)
+	}
+
+	if n := len(shardPayloads(payloads[:2], 4)); n != 2 {
+		t.Errorf("got %d shards for 2 payloads, want 2", n)
+	}
+}
+
+func TestExportShards(t *testing.T) {
+	shards := shardPayloads(make([]payload, 10), 4)
+
+	var exported atomic.Int64
+	err := exportShards(func(ps []payload) error {
+		exported.Add(int64(len(ps)))
+		return nil
+	}, shards)
+	if err != nil || exported.Load() != 10 {
+		t.Errorf("exported %d payloads, err %v; want 10, nil", exported.Load(), err)
+	}
+
+	boom := errors.New("boom")
+	err = exportShards(func([]payload) error { return boom }, shards)
+	if !errors.Is(err, boom) {
+		t.Errorf("err = %v, want %v", err, boom)
+	}
+}
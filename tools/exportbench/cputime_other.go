@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "time"
+
+// processCPUTime is not implemented on this platform and always returns 0.
+func processCPUTime() time.Duration { return 0 }
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/metrics"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	arrowpb "github.com/open-telemetry/otel-arrow/go/api/experimental/arrow/v1"
+	"github.com/open-telemetry/otel-arrow/go/pkg/otel/arrow_record"
+	"github.com/pierrec/lz4/v4"
+	"github.com/splunk/stef/go/pkg"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.opentelemetry.io/collector/pdata/pprofile/pprofileotlp"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+	"google.golang.org/grpc"
+)
+
+// decodeStats is the server-side cost of decoding received requests.
+type decodeStats struct {
+	requests int64
+	elapsed  time.Duration
+	// cpu is the CPU time of the decoding goroutines, 0 where thread CPU
+	// time cannot be read.
+	cpu        time.Duration
+	allocs     int64
+	allocBytes int64
+}
+
+// decodeMeter accumulates the wall time, CPU time and allocations spent
+// decoding requests into pdata on the server side of a nop server.
+//
+// Each decode is pinned to its OS thread, so the thread's CPU clock gives
+// the decode's own CPU time, while the wall time also counts the decoder
+// being descheduled. Allocations are only approximate: they are read from
+// the process-wide runtime/metrics counters around each decode, so they are
+// only attributable to the server while the client is blocked on the
+// response. That holds for the synchronous OTLP exporters at
+// --concurrency=1; with more concurrency, or with the STEF exporter's
+// queue, client allocations can leak into the server figures.
+type decodeMeter struct {
+	requests   atomic.Int64
+	nanos      atomic.Int64
+	cpuNanos   atomic.Int64
+	allocs     atomic.Int64
+	allocBytes atomic.Int64
+}
+
+func (m *decodeMeter) ReadAndReset() decodeStats {
+	return decodeStats{
+		requests:   m.requests.Swap(0),
+		elapsed:    time.Duration(m.nanos.Swap(0)),
+		cpu:        time.Duration(m.cpuNanos.Swap(0)),
+		allocs:     m.allocs.Swap(0),
+		allocBytes: m.allocBytes.Swap(0),
+	}
+}
+
+// observe runs fn and charges its time and allocations to the meter.
+func (m *decodeMeter) observe(fn func() error) error {
+	span := m.start()
+	err := fn()
+	span.stop()
+	m.requests.Add(1)
+	return err
+}
+
+// start locks the goroutine to its thread until the span stops.
+func (m *decodeMeter) start() decodeSpan {
+	runtime.LockOSThread()
+	objects, bytes := heapAllocs()
+	return decodeSpan{meter: m, start: time.Now(), cpu: threadCPUTime(), objects: objects, bytes: bytes}
+}
+
+// decodeSpan is one metered stretch of decoding work.
+type decodeSpan struct {
+	meter   *decodeMeter
+	start   time.Time
+	cpu     time.Duration
+	objects uint64
+	bytes   uint64
+}
+
+func (s decodeSpan) stop() {
+	cpu := threadCPUTime() - s.cpu
+	elapsed := time.Since(s.start)
+	objects, bytes := heapAllocs()
+	runtime.UnlockOSThread()
+	s.meter.nanos.Add(int64(elapsed))
+	s.meter.cpuNanos.Add(int64(cpu))
+	s.meter.allocs.Add(int64(objects - s.objects))
+	s.meter.allocBytes.Add(int64(bytes - s.bytes))
+}
+
+var allocSamples = []metrics.Sample{
+	{Name: "/gc/heap/allocs:objects"},
+	{Name: "/gc/heap/allocs:bytes"},
+}
+
+// heapAllocs returns the cumulative heap allocation counters. Unlike
+// runtime.ReadMemStats it does not stop the world, so it is cheap enough to
+// call around every request.
+func heapAllocs() (objects, bytes uint64) {
+	samples := make([]metrics.Sample, len(allocSamples))
+	copy(samples, allocSamples)
+	metrics.Read(samples)
+	return samples[0].Value.Uint64(), samples[1].Value.Uint64()
+}
+
+// decodeRequest unmarshals an OTLP export request body into pdata, the way a
+// collector receiver does.
+func decodeRequest(sig signal, body []byte, json bool) (payload, error) {
+	if !json {
+		return unmarshalPayload(sig, "", body)
+	}
+	p := payload{signal: sig}
+	var err error
+	switch sig {
+	case signalMetrics:
+		p.metrics = pmetricotlp.NewExportRequest()
+		err = p.metrics.UnmarshalJSON(body)
+	case signalLogs:
+		p.logs = plogotlp.NewExportRequest()
+		err = p.logs.UnmarshalJSON(body)
+	case signalTraces:
+		p.traces = ptraceotlp.NewExportRequest()
+		err = p.traces.UnmarshalJSON(body)
+	case signalProfiles:
+		p.profiles = pprofileotlp.NewExportRequest()
+		err = p.profiles.UnmarshalJSON(body)
+	default:
+		err = fmt.Errorf("unsupported signal %q", sig)
+	}
+	return p, err
+}
+
+// decompressBody undoes the Content-Encoding applied by confighttp, with the
+// same decoders the confighttp server uses.
+func decompressBody(encoding string, body []byte) ([]byte, error) {
+	var r io.Reader
+	switch encoding {
+	case "":
+		return body, nil
+	case "zstd":
+		return zstdDecoder.DecodeAll(body, nil)
+	case "gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		r = zr
+	case "zlib", "deflate":
+		zr, err := zlib.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		r = zr
+	case "snappy":
+		// Without the framed snappy feature gate, confighttp sends the
+		// framed format under the "snappy" encoding, so detect it.
+		if bytes.HasPrefix(body, snappyFramingHeader) {
+			r = snappy.NewReader(bytes.NewReader(body))
+		} else {
+			return snappy.Decode(nil, body)
+		}
+	case "x-snappy-framed":
+		r = snappy.NewReader(bytes.NewReader(body))
+	case "lz4":
+		r = lz4.NewReader(bytes.NewReader(body))
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+	return io.ReadAll(r)
+}
+
+// zstdDecoder is shared by every request, as DecodeAll is safe for
+// concurrent use, so that decoder construction is not charged to each
+// decode. confighttp likewise reuses its zstd decoders.
+var zstdDecoder, _ = zstd.NewReader(nil)
+
+// snappyFramingHeader starts every framed snappy stream.
+var snappyFramingHeader = []byte{0xff, 0x06, 0x00, 0x00, 's', 'N', 'a', 'P', 'p', 'Y'}
+
+// signalFromPath maps an OTLP/HTTP path or gRPC method to its signal.
+func signalFromPath(path string) (signal, bool) {
+	switch {
+	case strings.Contains(path, "metrics"), strings.Contains(path, "Metrics"):
+		return signalMetrics, true
+	case strings.Contains(path, "logs"), strings.Contains(path, "Logs"):
+		return signalLogs, true
+	case strings.Contains(path, "trace"), strings.Contains(path, "Trace"):
+		return signalTraces, true
+	case strings.Contains(path, "profiles"), strings.Contains(path, "Profiles"):
+		return signalProfiles, true
+	}
+	return "", false
+}
+
+// rawCodec hands gRPC message bytes to the handler untouched so that decode
+// mode can unmarshal them into pdata under its own meter.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v any) ([]byte, error) { return *(v.(*[]byte)), nil }
+func (rawCodec) Unmarshal(data []byte, v any) error {
+	*(v.(*[]byte)) = bytes.Clone(data)
+	return nil
+}
+func (rawCodec) Name() string { return "proto" }
+
+// decodingGRPCHandler serves every OTLP Export method: it decodes the raw
+// request into pdata and replies with an empty response, which is a valid
+// encoding of every Export*ServiceResponse.
+func decodingGRPCHandler(meter *decodeMeter, sink *captureSink) grpc.StreamHandler {
+	return func(_ any, stream grpc.ServerStream) error {
+		method, _ := grpc.MethodFromServerStream(stream)
+		sig, ok := signalFromPath(method)
+		if !ok {
+			return fmt.Errorf("unknown method %s", method)
+		}
+
+		var body []byte
+		if err := stream.RecvMsg(&body); err != nil {
+			return err
+		}
+		var p payload
+		err := meter.observe(func() (err error) {
+			p, err = decodeRequest(sig, body, false)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		sink.capture(p)
+		empty := []byte{}
+		return stream.SendMsg(&empty)
+	}
+}
+
+// pausingChunkReader excludes time spent waiting for STEF chunks from the
+// decode meter, so that only record decoding between chunks is charged.
+type pausingChunkReader struct {
+	src   pkg.ChunkReader
+	meter *decodeMeter
+	span  decodeSpan
+}
+
+func newPausingChunkReader(src pkg.ChunkReader, meter *decodeMeter) *pausingChunkReader {
+	return &pausingChunkReader{src: src, meter: meter, span: meter.start()}
+}
+
+func (r *pausingChunkReader) ReadChunk() ([]byte, error) {
+	r.span.stop()
+	chunk, err := r.src.ReadChunk()
+	r.span = r.meter.start()
+	return chunk, err
+}
+
+// close stops the meter once the stream ends, so that the decode work after
+// the last frame is charged and the goroutine leaves its thread unlocked.
+func (r *pausingChunkReader) close() {
+	r.span.stop()
+}
+
+// frameDone charges the decode work since the last chunk or frame to one
+// request and pauses the meter while done captures the frame and sends the
+// ACK.
+func (r *pausingChunkReader) frameDone(done func() error) error {
+	r.span.stop()
+	r.meter.requests.Add(1)
+	err := done()
+	r.span = r.meter.start()
+	return err
+}
+
+// decodeResult is the per-iteration mean of decodeStats. The request mean
+// is kept as a float, as a STEF stream that ends a frame only every few
+// iterations would otherwise average 0 requests.
+type decodeResult struct {
+	requests   float64
+	elapsed    time.Duration
+	cpu        time.Duration
+	allocs     int64
+	allocBytes int64
+}
+
+// meanDecodeStats averages the server-side decode cost over iterations.
+func meanDecodeStats(samples []iterationSample) *decodeResult {
+	var total decodeStats
+	for _, s := range samples {
+		total.requests += s.decode.requests
+		total.elapsed += s.decode.elapsed
+		total.cpu += s.decode.cpu
+		total.allocs += s.decode.allocs
+		total.allocBytes += s.decode.allocBytes
+	}
+	res := &decodeResult{requests: float64(total.requests)}
+	if n := int64(len(samples)); n > 0 {
+		res.requests /= float64(n)
+		res.elapsed = total.elapsed / time.Duration(n)
+		res.cpu = total.cpu / time.Duration(n)
+		res.allocs = total.allocs / n
+		res.allocBytes = total.allocBytes / n
+	}
+	return res
+}
+
+// decodeArrowBatch converts an OTel Arrow batch back into pdata, as the
+// otelarrowreceiver does.
+func decodeArrowBatch(consumer *arrow_record.Consumer, sig signal, batch *arrowpb.BatchArrowRecords) ([]payload, error) {
+	var out []payload
+	switch sig {
+	case signalMetrics:
+		mds, err := consumer.MetricsFrom(batch)
+		if err != nil {
+			return nil, err
+		}
+		for _, md := range mds {
+			out = append(out, payload{signal: sig, metrics: pmetricotlp.NewExportRequestFromMetrics(md)})
+		}
+	case signalLogs:
+		lds, err := consumer.LogsFrom(batch)
+		if err != nil {
+			return nil, err
+		}
+		for _, ld := range lds {
+			out = append(out, payload{signal: sig, logs: plogotlp.NewExportRequestFromLogs(ld)})
+		}
+	case signalTraces:
+		tds, err := consumer.TracesFrom(batch)
+		if err != nil {
+			return nil, err
+		}
+		for _, td := range tds {
+			out = append(out, payload{signal: sig, traces: ptraceotlp.NewExportRequestFromTraces(td)})
+		}
+	default:
+		return nil, fmt.Errorf("OTel Arrow does not carry %s", sig)
+	}
+	return out, nil
+}
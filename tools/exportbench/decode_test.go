@@ -0,0 +1,15 @@
+package main
+
+import "testing"
+
+func TestMeanDecodeStatsKeepsFractions(t *testing.T) {
+	samples := []iterationSample{
+		{decode: decodeStats{requests: 1, allocs: 30}},
+		{decode: decodeStats{}},
+		{decode: decodeStats{}},
+	}
+	d := meanDecodeStats(samples)
+	if d.requests != 1.0/3 || d.allocs != 10 {
+		t.Errorf("meanDecodeStats = %+v, want 1/3 request and 10 allocs", d)
+	}
+}
@@ -0,0 +1,540 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/splunk/stef/go/grpc/stef_proto"
+	"github.com/splunk/stef/go/pkg"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// faultConfig describes a degraded downstream for --faults. The zero value
+// injects nothing.
+type faultConfig struct {
+	// latency is added before every response.
+	latency time.Duration
+	// bandwidth caps each connection's receive rate in bytes per second.
+	bandwidth int64
+	// errors is the fraction of requests rejected as retryable: HTTP 429 or
+	// 503, gRPC UNAVAILABLE, or an Arrow batch status of UNAVAILABLE.
+	errors float64
+	// resets is the fraction of requests whose connection is reset.
+	resets float64
+	// ackDelay delays every STEF ACK.
+	ackDelay time.Duration
+	// ackWithhold is the fraction of STEF ACKs never sent. ACKs are
+	// cumulative, so 1 withholds all of them.
+	ackWithhold float64
+}
+
+// parseFaults parses a comma-separated list of key=value faults, such as
+// "latency=20ms,bandwidth=10MiB,errors=0.05,resets=0.01".
+func parseFaults(s string) (faultConfig, error) {
+	var f faultConfig
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return faultConfig{}, fmt.Errorf("fault %q: want key=value", entry)
+		}
+		var err error
+		switch key {
+		case "latency":
+			f.latency, err = time.ParseDuration(value)
+		case "bandwidth":
+			f.bandwidth, err = parseByteSize(value)
+		case "errors":
+			f.errors, err = parseFraction(value)
+		case "resets":
+			f.resets, err = parseFraction(value)
+		case "ack-delay":
+			f.ackDelay, err = time.ParseDuration(value)
+		case "ack-withhold":
+			f.ackWithhold, err = parseFraction(value)
+		default:
+			return faultConfig{}, fmt.Errorf("unknown fault %q (want latency, bandwidth, errors, resets, ack-delay or ack-withhold)", key)
+		}
+		if err != nil {
+			return faultConfig{}, fmt.Errorf("fault %q: %w", entry, err)
+		}
+		if f.latency < 0 || f.ackDelay < 0 || f.bandwidth < 0 {
+			return faultConfig{}, fmt.Errorf("fault %q: must not be negative", entry)
+		}
+	}
+	if f.errors+f.resets > 1 {
+		return faultConfig{}, fmt.Errorf("errors and resets add up to more than 1")
+	}
+	return f, nil
+}
+
+func parseFraction(s string) (float64, error) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(v) || v < 0 || v > 1 {
+		return 0, fmt.Errorf("%v is not between 0 and 1", v)
+	}
+	return v, nil
+}
+
+// parseByteSize parses a byte count with an optional decimal (kB, MB, GB) or
+// binary (KiB, MiB, GiB) suffix.
+func parseByteSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		scale  float64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+		{"kB", 1e3}, {"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"B", 1},
+	}
+	scale := 1.0
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s, scale = strings.TrimSuffix(s, u.suffix), u.scale
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(v * scale), nil
+}
+
+// formatByteSize is the inverse of parseByteSize for exact binary units.
+func formatByteSize(n int64) string {
+	for _, u := range []struct {
+		suffix string
+		scale  int64
+	}{{"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10}} {
+		if n%u.scale == 0 {
+			return strconv.FormatInt(n/u.scale, 10) + u.suffix
+		}
+	}
+	return strconv.FormatInt(n, 10) + "B"
+}
+
+func (f faultConfig) active() bool {
+	return f != faultConfig{}
+}
+
+// String returns the faults in --faults syntax.
+func (f faultConfig) String() string {
+	var parts []string
+	if f.latency > 0 {
+		parts = append(parts, "latency="+f.latency.String())
+	}
+	if f.bandwidth > 0 {
+		parts = append(parts, "bandwidth="+formatByteSize(f.bandwidth))
+	}
+	if f.errors > 0 {
+		parts = append(parts, fmt.Sprintf("errors=%g", f.errors))
+	}
+	if f.resets > 0 {
+		parts = append(parts, fmt.Sprintf("resets=%g", f.resets))
+	}
+	if f.ackDelay > 0 {
+		parts = append(parts, "ack-delay="+f.ackDelay.String())
+	}
+	if f.ackWithhold > 0 {
+		parts = append(parts, fmt.Sprintf("ack-withhold=%g", f.ackWithhold))
+	}
+	return strings.Join(parts, ",")
+}
+
+// faultStats counts what a server injected.
+type faultStats struct {
+	rejected     int64
+	resets       int64
+	withheldAcks int64
+}
+
+type faultCounter struct {
+	rejected     atomic.Int64
+	resets       atomic.Int64
+	withheldAcks atomic.Int64
+}
+
+func (c *faultCounter) ReadAndReset() faultStats {
+	return faultStats{
+		rejected:     c.rejected.Swap(0),
+		resets:       c.resets.Swap(0),
+		withheldAcks: c.withheldAcks.Swap(0),
+	}
+}
+
+// faultAction is the outcome of a request under faultInjector.
+type faultAction int
+
+const (
+	faultNone faultAction = iota
+	faultReject
+	faultReset
+)
+
+// faultInjector applies a faultConfig to one server.
+type faultInjector struct {
+	cfg     faultConfig
+	lis     *faultListener
+	counter *faultCounter
+}
+
+// newFaultInjector wraps lis so that connections can be throttled and reset.
+// It returns a nil injector, and lis unchanged, when cfg is inactive.
+func newFaultInjector(cfg faultConfig, lis net.Listener) (*faultInjector, net.Listener) {
+	if !cfg.active() {
+		return nil, lis
+	}
+	fl := &faultListener{Listener: lis, bandwidth: cfg.bandwidth, conns: map[string]*faultConn{}}
+	return &faultInjector{cfg: cfg, lis: fl, counter: &faultCounter{}}, fl
+}
+
+// apply waits out the configured latency, then decides whether the request
+// from addr fails. A reset closes the client's connection before returning.
+func (fi *faultInjector) apply(addr string) faultAction {
+	if fi == nil {
+		return faultNone
+	}
+	if fi.cfg.latency > 0 {
+		time.Sleep(fi.cfg.latency)
+	}
+	switch r := rand.Float64(); {
+	case r < fi.cfg.resets:
+		fi.counter.resets.Add(1)
+		fi.lis.reset(addr)
+		return faultReset
+	case r < fi.cfg.resets+fi.cfg.errors:
+		fi.counter.rejected.Add(1)
+		return faultReject
+	}
+	return faultNone
+}
+
+func (fi *faultInjector) faultCounter() *faultCounter {
+	if fi == nil {
+		return nil
+	}
+	return fi.counter
+}
+
+// applyGRPC is apply for a gRPC call, returning the status to fail it with.
+func (fi *faultInjector) applyGRPC(ctx context.Context) error {
+	switch fi.apply(peerAddr(ctx)) {
+	case faultReset:
+		return status.Error(codes.Unavailable, "injected connection reset")
+	case faultReject:
+		return status.Error(codes.Unavailable, "injected fault")
+	}
+	return nil
+}
+
+// peerAddr returns the client address of a gRPC call, as faultListener
+// knows it.
+func peerAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// grpcOptions returns interceptors that inject faults into every unary call
+// and every stream that is handled as a single request, such as the
+// decoding OTLP handler.
+func (fi *faultInjector) grpcOptions() []grpc.ServerOption {
+	if fi == nil {
+		return nil
+	}
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := fi.applyGRPC(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := fi.applyGRPC(ss.Context()); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	}
+}
+
+// httpHandler wraps next, rejecting requests with 429 or 503 at random.
+func (fi *faultInjector) httpHandler(next http.Handler) http.Handler {
+	if fi == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch fi.apply(r.RemoteAddr) {
+		case faultReset:
+			return
+		case faultReject:
+			code := http.StatusServiceUnavailable
+			if rand.IntN(2) == 0 {
+				code = http.StatusTooManyRequests
+			}
+			http.Error(w, "injected fault", code)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// faultListener tracks accepted connections by remote address, so that a
+// handler can reset the connection its request arrived on.
+type faultListener struct {
+	net.Listener
+	bandwidth int64
+
+	mu    sync.Mutex
+	conns map[string]*faultConn
+}
+
+func (l *faultListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	fc := &faultConn{Conn: c, lis: l, bandwidth: l.bandwidth}
+	l.mu.Lock()
+	l.conns[c.RemoteAddr().String()] = fc
+	l.mu.Unlock()
+	return fc, nil
+}
+
+// reset closes the connection from addr with an RST rather than a FIN. An
+// empty addr resets every connection, for protocols that do not expose the
+// peer of a request.
+func (l *faultListener) reset(addr string) {
+	l.mu.Lock()
+	var conns []*faultConn
+	for a, c := range l.conns {
+		if addr == "" || a == addr {
+			conns = append(conns, c)
+		}
+	}
+	l.mu.Unlock()
+	for _, c := range conns {
+		if tcp, ok := c.Conn.(*net.TCPConn); ok {
+			tcp.SetLinger(0)
+		}
+		c.Close()
+	}
+}
+
+// faultConn throttles reads to a bandwidth cap.
+type faultConn struct {
+	net.Conn
+	lis       *faultListener
+	bandwidth int64
+	once      sync.Once
+}
+
+func (c *faultConn) Read(b []byte) (int, error) {
+	if c.bandwidth > 0 {
+		// Read at most 10ms worth of bytes at a time, so the cap is
+		// smooth rather than bursty.
+		b = b[:min(int64(len(b)), max(c.bandwidth/100, 1))]
+	}
+	n, err := c.Conn.Read(b)
+	if c.bandwidth > 0 && n > 0 {
+		time.Sleep(time.Duration(n) * time.Second / time.Duration(c.bandwidth))
+	}
+	return n, err
+}
+
+func (c *faultConn) Close() error {
+	c.once.Do(func() {
+		c.lis.mu.Lock()
+		delete(c.lis.conns, c.RemoteAddr().String())
+		c.lis.mu.Unlock()
+	})
+	return c.Conn.Close()
+}
+
+// faultChunkReader injects faults into a STEF stream, rolling once per
+// chunk. STEF has no per-request status, so a rejection ends the stream with
+// UNAVAILABLE, and the stream's peer is unknown, so a reset closes every
+// connection to the server.
+type faultChunkReader struct {
+	src pkg.ChunkReader
+	fi  *faultInjector
+}
+
+func (fi *faultInjector) stefReader(src pkg.ChunkReader) pkg.ChunkReader {
+	if fi == nil {
+		return src
+	}
+	return &faultChunkReader{src: src, fi: fi}
+}
+
+func (r *faultChunkReader) ReadChunk() ([]byte, error) {
+	chunk, err := r.src.ReadChunk()
+	if err != nil {
+		return chunk, err
+	}
+	switch r.fi.apply("") {
+	case faultReset:
+		return nil, status.Error(codes.Unavailable, "injected connection reset")
+	case faultReject:
+		return nil, status.Error(codes.Unavailable, "injected fault")
+	}
+	return chunk, nil
+}
+
+// stefAcker sends STEF ACKs, delaying or withholding them as configured.
+// Delayed ACKs are sent in order from a separate goroutine, so that reading
+// the stream is not held up.
+type stefAcker struct {
+	send     func(*stef_proto.STEFDataResponse) error
+	delay    time.Duration
+	withhold float64
+	counter  *faultCounter
+	pending  chan stefAck
+	closing  chan struct{}
+	done     chan struct{}
+}
+
+type stefAck struct {
+	id  uint64
+	due time.Time
+}
+
+func newSTEFAcker(fi *faultInjector, send func(*stef_proto.STEFDataResponse) error) *stefAcker {
+	a := &stefAcker{send: send}
+	if fi == nil {
+		return a
+	}
+	a.delay, a.withhold, a.counter = fi.cfg.ackDelay, fi.cfg.ackWithhold, fi.counter
+	if a.delay > 0 {
+		a.pending = make(chan stefAck, 1024)
+		a.closing = make(chan struct{})
+		a.done = make(chan struct{})
+		go a.run()
+	}
+	return a
+}
+
+func (a *stefAcker) ack(id uint64) error {
+	if a.withhold > 0 && rand.Float64() < a.withhold {
+		a.counter.withheldAcks.Add(1)
+		return nil
+	}
+	if a.pending == nil {
+		return a.send(&stef_proto.STEFDataResponse{AckRecordId: id})
+	}
+	a.pending <- stefAck{id: id, due: time.Now().Add(a.delay)}
+	return nil
+}
+
+func (a *stefAcker) run() {
+	defer close(a.done)
+	for ack := range a.pending {
+		timer := time.NewTimer(time.Until(ack.due))
+		select {
+		case <-timer.C:
+		case <-a.closing:
+			timer.Stop()
+			return
+		}
+		if err := a.send(&stef_proto.STEFDataResponse{AckRecordId: ack.id}); err != nil {
+			// The stream is gone; drain what is left.
+			for range a.pending {
+			}
+			return
+		}
+	}
+}
+
+// close stops the delayed ACK goroutine without waiting for the ACKs that
+// are not due yet; they are dropped, as the stream is ending.
+func (a *stefAcker) close() {
+	if a.pending != nil {
+		close(a.closing)
+		close(a.pending)
+		<-a.done
+	}
+}
+
+// deliveryStats is what an exporter did with a degraded downstream.
+type deliveryStats struct {
+	retries int64
+	dropped int64
+	faultStats
+}
+
+// deliveryResult is the per-iteration mean of deliveryStats, and the heap
+// growth over all timed iterations. The means are kept as floats, as a few
+// retries or faults over many iterations would otherwise round down to 0.
+type deliveryResult struct {
+	retries      float64
+	dropped      float64
+	rejected     float64
+	resets       float64
+	withheldAcks float64
+	heap         heapGrowth
+}
+
+func meanDelivery(samples []iterationSample, heap heapGrowth) *deliveryResult {
+	res := &deliveryResult{heap: heap}
+	for _, s := range samples {
+		res.retries += float64(s.delivery.retries)
+		res.dropped += float64(s.delivery.dropped)
+		res.rejected += float64(s.delivery.rejected)
+		res.resets += float64(s.delivery.resets)
+		res.withheldAcks += float64(s.delivery.withheldAcks)
+	}
+	if n := float64(len(samples)); n > 0 {
+		res.retries /= n
+		res.dropped /= n
+		res.rejected /= n
+		res.resets /= n
+		res.withheldAcks /= n
+	}
+	return res
+}
+
+// retryCounter is a zap core that counts exporterhelper's retry messages
+// and discards everything else.
+type retryCounter struct {
+	retries atomic.Int64
+}
+
+func (c *retryCounter) logger() *zap.Logger {
+	return zap.New(retryCountingCore{c})
+}
+
+type retryCountingCore struct {
+	c *retryCounter
+}
+
+func (r retryCountingCore) Enabled(l zapcore.Level) bool               { return l >= zapcore.InfoLevel }
+func (r retryCountingCore) With([]zapcore.Field) zapcore.Core          { return r }
+func (r retryCountingCore) Sync() error                                { return nil }
+func (r retryCountingCore) Write(zapcore.Entry, []zapcore.Field) error { return nil }
+func (r retryCountingCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if strings.HasPrefix(e.Message, "Exporting failed. Will retry") {
+		r.c.retries.Add(1)
+	}
+	return ce
+}
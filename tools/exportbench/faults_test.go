@@ -0,0 +1,156 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/splunk/stef/go/grpc/stef_proto"
+	"go.opentelemetry.io/collector/exporter/otlphttpexporter"
+)
+
+func TestParseFaults(t *testing.T) {
+	f, err := parseFaults("latency=20ms, bandwidth=10MiB,errors=0.05,resets=0.01,ack-delay=1s,ack-withhold=0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := faultConfig{
+		latency:     20 * time.Millisecond,
+		bandwidth:   10 << 20,
+		errors:      0.05,
+		resets:      0.01,
+		ackDelay:    time.Second,
+		ackWithhold: 0.1,
+	}
+	if f != want {
+		t.Errorf("parseFaults = %+v, want %+v", f, want)
+	}
+	if got := f.String(); got != "latency=20ms,bandwidth=10MiB,errors=0.05,resets=0.01,ack-delay=1s,ack-withhold=0.1" {
+		t.Errorf("String() = %q", got)
+	}
+
+	if f, err := parseFaults(""); err != nil || f.active() {
+		t.Errorf("parseFaults(\"\") = %+v, %v, want no faults", f, err)
+	}
+
+	for s, want := range map[string]int64{"512": 512, "1kB": 1000, "2KiB": 2048, "3MB": 3e6, "1GiB": 1 << 30} {
+		f, err := parseFaults("bandwidth=" + s)
+		if err != nil || f.bandwidth != want {
+			t.Errorf("bandwidth=%s = %d, %v, want %d", s, f.bandwidth, err, want)
+		}
+	}
+
+	for _, bad := range []string{"latency", "jitter=1ms", "latency=-1s", "errors=2", "bandwidth=1XB", "errors=0.6,resets=0.6", "errors=NaN"} {
+		if _, err := parseFaults(bad); err == nil {
+			t.Errorf("parseFaults(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestFaultyServerDropsItems(t *testing.T) {
+	faults, err := parseFaults("errors=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, err := startHTTPServer(serverOptions{faults: faults})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop()
+
+	// Without retries every rejected request drops its items, and the
+	// export itself still succeeds.
+	f := newHTTPFormat("faulty", testSignal, srv, otlphttpexporter.EncodingProto, codec{}, queueMode{})
+	if err := f.setup(); err != nil {
+		t.Fatal(err)
+	}
+	defer f.cleanup()
+	if err := f.export(testPayloads); err != nil {
+		t.Fatal(err)
+	}
+
+	var items int64
+	for _, p := range testPayloads {
+		items += int64(p.itemCount())
+	}
+	d := f.delivery()
+	if d.dropped != items || d.rejected != int64(len(testPayloads)) || d.retries != 0 {
+		t.Errorf("delivery = %+v, want %d dropped and %d rejected", d, items, len(testPayloads))
+	}
+}
+
+func TestRetriesAreCounted(t *testing.T) {
+	faults, err := parseFaults("errors=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, err := startHTTPServer(serverOptions{faults: faults})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop()
+
+	// Every attempt is rejected, so exporterhelper retries until the
+	// elapsed time runs out and then drops the request.
+	q, err := parseQueueMode("", "", time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.retry.MaxInterval = 5 * time.Millisecond
+	q.retry.MaxElapsedTime = 100 * time.Millisecond
+	f := newHTTPFormat("retrying", testSignal, srv, otlphttpexporter.EncodingProto, codec{}, q)
+	if err := f.setup(); err != nil {
+		t.Fatal(err)
+	}
+	defer f.cleanup()
+	if err := f.export(testPayloads[:1]); err != nil {
+		t.Fatal(err)
+	}
+
+	d := f.delivery()
+	if d.retries == 0 {
+		t.Errorf("delivery = %+v, want retries counted", d)
+	}
+	if want := int64(testPayloads[0].itemCount()); d.dropped != want {
+		t.Errorf("dropped = %d, want %d", d.dropped, want)
+	}
+}
+
+func TestMeanDeliveryKeepsFractions(t *testing.T) {
+	samples := []iterationSample{
+		{delivery: deliveryStats{retries: 1}},
+		{delivery: deliveryStats{}},
+		{delivery: deliveryStats{retries: 2, dropped: 1}},
+	}
+	d := meanDelivery(samples, heapGrowth{})
+	if d.retries != 1 || d.dropped != 1.0/3 {
+		t.Errorf("meanDelivery = %+v, want 1 retry and 1/3 dropped", d)
+	}
+}
+
+func TestSTEFAckerCloseDropsPendingAcks(t *testing.T) {
+	fi := &faultInjector{cfg: faultConfig{ackDelay: time.Hour}, counter: &faultCounter{}}
+	var sent int
+	a := newSTEFAcker(fi, func(*stef_proto.STEFDataResponse) error {
+		sent++
+		return nil
+	})
+	for id := range uint64(3) {
+		if err := a.ack(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		a.close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("close waited for delayed ACKs")
+	}
+	if sent != 0 {
+		t.Errorf("sent %d ACKs that were not due", sent)
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !linux
+
+package main
+
+// openFDs is not implemented on this platform and always returns -1.
+func openFDs() int { return -1 }
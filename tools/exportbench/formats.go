@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/collector/exporter"
+	"go.opentelemetry.io/collector/exporter/otlpexporter"
+	"go.opentelemetry.io/collector/exporter/otlphttpexporter"
+
+	"github.com/open-telemetry/opentelemetry-collector-contrib/exporter/otelarrowexporter"
+	"github.com/open-telemetry/opentelemetry-collector-contrib/exporter/stefexporter"
+)
+
+// transport is one exporter configuration of the built-in matrix, which
+// buildFormats expands by codec. The CLI and BenchmarkExport both build
+// their formats from transports, so one added here shows up in both.
+type transport struct {
+	name string
+	// sep joins the name and a compressed codec, as in "OTLP gRPC + zstd".
+	// Without one the codec is always shown, as in "STEF (none)".
+	sep string
+	// factory is only consulted for the signals the exporter supports.
+	factory exporter.Factory
+	// codecs reports whether the client config can send with a codec, and
+	// codecNote says which ones it can. nil accepts every codec.
+	codecs    func(codec) bool
+	codecNote string
+	build     func(name string, sig signal, srvs nopServers, c codec, q queueMode) benchFormat
+}
+
+func (t transport) formatName(c codec) string {
+	if t.sep == "" {
+		return t.name + " (" + c.String() + ")"
+	}
+	return c.formatName(t.name, t.sep)
+}
+
+const grpcCodecNote = "gRPC supports gzip, snappy and zstd without levels"
+
+// transports is the built-in matrix, in report order.
+var transports = []transport{
+	{
+		name:      "OTLP gRPC",
+		sep:       " + ",
+		factory:   otlpexporter.NewFactory(),
+		codecs:    codec.grpcSupported,
+		codecNote: grpcCodecNote,
+		build: func(name string, sig signal, srvs nopServers, c codec, q queueMode) benchFormat {
+			return newGRPCFormat(name, sig, srvs.grpc, c, q)
+		},
+	},
+	{
+		name:    "OTLP HTTP proto",
+		sep:     "+",
+		factory: otlphttpexporter.NewFactory(),
+		build: func(name string, sig signal, srvs nopServers, c codec, q queueMode) benchFormat {
+			return newHTTPFormat(name, sig, srvs.http, otlphttpexporter.EncodingProto, c, q)
+		},
+	},
+	{
+		name:    "OTLP HTTP JSON",
+		sep:     "+",
+		factory: otlphttpexporter.NewFactory(),
+		build: func(name string, sig signal, srvs nopServers, c codec, q queueMode) benchFormat {
+			return newHTTPFormat(name, sig, srvs.http, otlphttpexporter.EncodingJSON, c, q)
+		},
+	},
+	{
+		name:      "OTel Arrow",
+		sep:       " + ",
+		factory:   otelarrowexporter.NewFactory(),
+		codecs:    codec.grpcSupported,
+		codecNote: grpcCodecNote,
+		build: func(name string, sig signal, srvs nopServers, c codec, q queueMode) benchFormat {
+			return newArrowFormat(name, sig, srvs.arrow, c, q)
+		},
+	},
+	{
+		name:      "STEF",
+		factory:   stefexporter.NewFactory(),
+		codecs:    codec.stefSupported,
+		codecNote: "stefexporter supports zstd without levels",
+		build: func(name string, _ signal, srvs nopServers, c codec, q queueMode) benchFormat {
+			return newSTEFExporterFormat(name, srvs.stef, c, q)
+		},
+	},
+}
+
+// buildFormats expands the transports by codec, as listed by expandMatrix.
+func buildFormats(sig signal, codecs []codec, srvs nopServers, q queueMode) []benchFormat {
+	var formats []benchFormat
+	for _, e := range expandMatrix(sig, codecs) {
+		f := e.t.build(e.name(), sig, srvs, e.c, q)
+		// A batching queue merges requests, so --verify can only match
+		// items.
+		if q.batch != "" {
+			f.regroups = true
+		}
+		formats = append(formats, f)
+	}
+	return formats
+}
+
+// formatNames lists the names of the formats buildFormats would build,
+// without nop servers to point them at.
+func formatNames(sig signal, codecs []codec) []string {
+	var names []string
+	for _, e := range expandMatrix(sig, codecs) {
+		names = append(names, e.name())
+	}
+	return names
+}
+
+// matrixEntry is one format of the built-in matrix.
+type matrixEntry struct {
+	t transport
+	c codec
+}
+
+func (e matrixEntry) name() string { return e.t.formatName(e.c) }
+
+// expandMatrix pairs the transports with codecs, in report order.
+// Transports skip signals their exporter has no pipeline for and codecs
+// their client config cannot send, and say so on stderr.
+func expandMatrix(sig signal, codecs []codec) []matrixEntry {
+	var entries []matrixEntry
+	// Transports with the same codec restrictions share one note.
+	type codecSkip struct{ transports, codecs []string }
+	var notes []string
+	skipped := map[string]*codecSkip{}
+	for _, t := range transports {
+		if !supportsSignal(t.factory, sig) {
+			fmt.Fprintf(os.Stderr, "skipping %s: %sexporter does not support %s\n", t.name, t.factory.Type(), sig)
+			continue
+		}
+		for _, c := range codecs {
+			if t.codecs == nil || t.codecs(c) {
+				entries = append(entries, matrixEntry{t: t, c: c})
+				continue
+			}
+			s := skipped[t.codecNote]
+			if s == nil {
+				s = &codecSkip{}
+				skipped[t.codecNote] = s
+				notes = append(notes, t.codecNote)
+			}
+			if !slices.Contains(s.transports, t.name) {
+				s.transports = append(s.transports, t.name)
+			}
+			if !slices.Contains(s.codecs, c.String()) {
+				s.codecs = append(s.codecs, c.String())
+			}
+		}
+	}
+	for _, note := range notes {
+		s := skipped[note]
+		fmt.Fprintf(os.Stderr, "skipping %s with %s: %s\n",
+			strings.Join(s.transports, " and "), strings.Join(s.codecs, ", "), note)
+	}
+	return entries
+}
+
+// formatKeyReplacer turns a format name into a key without spaces or
+// punctuation: "OTLP gRPC + zstd" becomes "OTLP_gRPC_zstd" and "STEF (none)"
+// becomes "STEF_none".
+var formatKeyReplacer = strings.NewReplacer(" + ", "_", "+", "_", " (", "_", ")", "", " ", "_")
+
+// formatKey is a format's name as BenchmarkExport names its sub-benchmark,
+// which --format also accepts.
+func formatKey(name string) string {
+	return formatKeyReplacer.Replace(name)
+}
@@ -0,0 +1,61 @@
+package main
+
+import "testing"
+
+func TestFormatKey(t *testing.T) {
+	for name, want := range map[string]string{
+		"OTLP gRPC":              "OTLP_gRPC",
+		"OTLP gRPC + zstd":       "OTLP_gRPC_zstd",
+		"OTLP HTTP proto+gzip:9": "OTLP_HTTP_proto_gzip:9",
+		"STEF (none)":            "STEF_none",
+	} {
+		if got := formatKey(name); got != want {
+			t.Errorf("formatKey(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestBuildFormats(t *testing.T) {
+	codecs, err := parseCodecs("none,zstd,lz4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		sig  signal
+		want []string
+	}{
+		{signalMetrics, []string{
+			"OTLP_gRPC", "OTLP_gRPC_zstd",
+			"OTLP_HTTP_proto", "OTLP_HTTP_proto_zstd", "OTLP_HTTP_proto_lz4",
+			"OTLP_HTTP_JSON", "OTLP_HTTP_JSON_zstd", "OTLP_HTTP_JSON_lz4",
+			"OTel_Arrow", "OTel_Arrow_zstd",
+			"STEF_none", "STEF_zstd",
+		}},
+		{signalProfiles, []string{
+			"OTLP_gRPC", "OTLP_gRPC_zstd",
+			"OTLP_HTTP_proto", "OTLP_HTTP_proto_zstd", "OTLP_HTTP_proto_lz4",
+			"OTLP_HTTP_JSON", "OTLP_HTTP_JSON_zstd", "OTLP_HTTP_JSON_lz4",
+		}},
+	} {
+		formats := buildFormats(tc.sig, codecs, testNopServers(), queueMode{})
+		if len(formats) != len(tc.want) {
+			t.Fatalf("%s: %d formats, want %d", tc.sig, len(formats), len(tc.want))
+		}
+		// --isolate names the formats without building them.
+		names := formatNames(tc.sig, codecs)
+		if len(names) != len(formats) {
+			t.Fatalf("%s: %d format names, want %d", tc.sig, len(names), len(formats))
+		}
+		for i, f := range formats {
+			if names[i] != f.name {
+				t.Errorf("%s: format name %d = %q, want %q", tc.sig, i, names[i], f.name)
+			}
+			if got := formatKey(f.name); got != tc.want[i] {
+				t.Errorf("%s: format %d = %q, want %q", tc.sig, i, got, tc.want[i])
+			}
+			if sel, err := selectFormat(formats, tc.want[i]); err != nil || sel[0].name != f.name {
+				t.Errorf("%s: selectFormat(%q) = %v, %v", tc.sig, tc.want[i], sel, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"math"
+	"runtime"
+	"runtime/metrics"
+	"time"
+)
+
+// heapObjectsMetric is the heap memory occupied by live and not yet swept
+// objects.
+const heapObjectsMetric = "/memory/classes/heap/objects:bytes"
+
+const (
+	stacksMetric   = "/memory/classes/heap/stacks:bytes"
+	totalMetric    = "/memory/classes/total:bytes"
+	releasedMetric = "/memory/classes/heap/released:bytes"
+	gcCyclesMetric = "/gc/cycles/total:gc-cycles"
+	gcPausesMetric = "/sched/pauses/total/gc:seconds"
+)
+
+// sampledMetrics are read on every tick of a heapSampler, in this order.
+var sampledMetrics = []string{heapObjectsMetric, stacksMetric, totalMetric, releasedMetric}
+
+// heapGrowth tracks how far the heap grows above its level when the
+// sampler started, e.g. while a queue backs up behind a slow server.
+type heapGrowth struct {
+	peak     int64
+	retained int64
+	// mean is the average growth over all samples, the steady-state
+	// footprint of a replay.
+	mean int64
+}
+
+// memoryPeaks are the high-water marks while a heapSampler ran, and the
+// garbage collections in that time. Unlike allocated bytes, which measure
+// churn, they are the footprint a memory_limiter would see. runtime is all
+// memory the Go runtime has mapped and not returned to the OS, the closest
+// in-process estimate of RSS.
+type memoryPeaks struct {
+	heap    int64
+	stacks  int64
+	runtime int64
+	gcs     int64
+	// gcPause is estimated from the midpoints of the pause histogram's
+	// buckets, and gcPauseMax is the upper bound of the highest bucket.
+	gcPause    time.Duration
+	gcPauseMax time.Duration
+}
+
+// heapSampler samples the heap, goroutine stacks and runtime memory every
+// 10ms in the background. Reading runtime/metrics does not stop the world.
+type heapSampler struct {
+	base    int64
+	peaks   memoryPeaks
+	sum     int64
+	n       int64
+	gcStart []metrics.Sample
+	stopCh  chan struct{}
+	done    chan struct{}
+}
+
+func readHeapObjects() int64 {
+	s := []metrics.Sample{{Name: heapObjectsMetric}}
+	metrics.Read(s)
+	return int64(s[0].Value.Uint64())
+}
+
+func readGCMetrics() []metrics.Sample {
+	s := []metrics.Sample{{Name: gcCyclesMetric}, {Name: gcPausesMetric}}
+	metrics.Read(s)
+	return s
+}
+
+// startHeapSampler collects garbage first, so the baseline is the heap the
+// benchmark actually retains.
+func startHeapSampler() *heapSampler {
+	runtime.GC()
+	h := &heapSampler{stopCh: make(chan struct{}), done: make(chan struct{})}
+	samples := make([]metrics.Sample, len(sampledMetrics))
+	for i, name := range sampledMetrics {
+		samples[i].Name = name
+	}
+	h.sample(samples)
+	h.base = h.peaks.heap
+	h.gcStart = readGCMetrics()
+	go func() {
+		defer close(h.done)
+		t := time.NewTicker(10 * time.Millisecond)
+		defer t.Stop()
+		for {
+			select {
+			case <-h.stopCh:
+				return
+			case <-t.C:
+				h.sample(samples)
+				h.sum += int64(samples[0].Value.Uint64())
+				h.n++
+			}
+		}
+	}()
+	return h
+}
+
+func (h *heapSampler) sample(samples []metrics.Sample) {
+	metrics.Read(samples)
+	p := &h.peaks
+	p.heap = max(p.heap, int64(samples[0].Value.Uint64()))
+	p.stacks = max(p.stacks, int64(samples[1].Value.Uint64()))
+	p.runtime = max(p.runtime, int64(samples[2].Value.Uint64()-samples[3].Value.Uint64()))
+}
+
+// stop returns the peak growth, and the growth still retained after a
+// garbage collection. The peaks are available from memory afterwards.
+func (h *heapSampler) stop() heapGrowth {
+	close(h.stopCh)
+	<-h.done
+	gcEnd := readGCMetrics()
+	h.peaks.gcs = int64(gcEnd[0].Value.Uint64() - h.gcStart[0].Value.Uint64())
+	h.peaks.gcPause, h.peaks.gcPauseMax = pauseDelta(h.gcStart[1].Value.Float64Histogram(), gcEnd[1].Value.Float64Histogram())
+
+	runtime.GC()
+	g := heapGrowth{
+		peak:     max(h.peaks.heap-h.base, 0),
+		retained: max(readHeapObjects()-h.base, 0),
+	}
+	if h.n > 0 {
+		g.mean = max(h.sum/h.n-h.base, 0)
+	}
+	return g
+}
+
+// memory returns the high-water marks and GC activity between start and
+// stop.
+func (h *heapSampler) memory() memoryPeaks { return h.peaks }
+
+// pauseDelta sums the pauses recorded in a duration histogram between two
+// reads, and bounds the longest of them.
+func pauseDelta(before, after *metrics.Float64Histogram) (total, longest time.Duration) {
+	var secs, maxSecs float64
+	for i, n := range after.Counts {
+		if i < len(before.Counts) {
+			n -= before.Counts[i]
+		}
+		if n == 0 {
+			continue
+		}
+		lo, hi := after.Buckets[i], after.Buckets[i+1]
+		if math.IsInf(lo, -1) {
+			lo = 0
+		}
+		if math.IsInf(hi, 1) {
+			hi = lo
+		}
+		secs += float64(n) * (lo + hi) / 2
+		maxSecs = hi
+	}
+	return time.Duration(secs * float64(time.Second)), time.Duration(maxSecs * float64(time.Second))
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"math"
+	"runtime"
+	"runtime/metrics"
+	"testing"
+	"time"
+)
+
+func TestPauseDelta(t *testing.T) {
+	buckets := []float64{math.Inf(-1), 0.001, 0.002, 0.004, math.Inf(1)}
+	before := &metrics.Float64Histogram{Counts: []uint64{0, 1, 0, 0}, Buckets: buckets}
+	after := &metrics.Float64Histogram{Counts: []uint64{0, 3, 1, 0}, Buckets: buckets}
+	total, longest := pauseDelta(before, after)
+	// Two pauses of about 1.5ms and one of about 3ms.
+	if want := 6 * time.Millisecond; total != want {
+		t.Errorf("total = %s, want %s", total, want)
+	}
+	if want := 4 * time.Millisecond; longest != want {
+		t.Errorf("longest = %s, want %s", longest, want)
+	}
+	if total, longest := pauseDelta(after, after); total != 0 || longest != 0 {
+		t.Errorf("no pauses = %s, %s", total, longest)
+	}
+}
+
+var retainedForSampler [][]byte
+
+func TestHeapSamplerPeaks(t *testing.T) {
+	h := startHeapSampler()
+	for range 64 {
+		retainedForSampler = append(retainedForSampler, make([]byte, 256<<10))
+	}
+	time.Sleep(50 * time.Millisecond)
+	runtime.GC()
+	growth := h.stop()
+	m := h.memory()
+	retainedForSampler = nil
+
+	if growth.peak < 16<<20 {
+		t.Errorf("peak heap growth = %d, want at least 16MiB", growth.peak)
+	}
+	if m.heap < h.base+16<<20 || m.runtime < m.heap || m.stacks <= 0 {
+		t.Errorf("peaks = %+v", m)
+	}
+	if m.gcs < 1 {
+		t.Errorf("%d GC cycles, want at least 1", m.gcs)
+	}
+}
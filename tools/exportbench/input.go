@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// inputExtensions are the payload file extensions loadPayloads reads, after
+// an optional .gz, .zst or .zstd suffix. Files without an extension are
+// sniffed, as the file exporter writes to whatever path it is given.
+var inputExtensions = map[string]bool{
+	".pb": true, ".binpb": true, ".proto": true,
+	".json": true, ".jsonl": true, ".ndjson": true,
+	"": true,
+}
+
+func isInputFile(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	return inputExtensions[filepath.Ext(trimCompression(name))]
+}
+
+// hasNoExtension reports whether an input file name has no extension, apart
+// from a compression suffix, so that it is only read if it sniffs as OTLP.
+func hasNoExtension(name string) bool {
+	return filepath.Ext(trimCompression(name)) == ""
+}
+
+func trimCompression(name string) string {
+	switch filepath.Ext(name) {
+	case ".gz", ".zst", ".zstd":
+		return strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	return name
+}
+
+// sniffPayloads reports whether every request in msgs is OTLP with items,
+// so that files without an extension, such as a README or LICENSE next to
+// the payloads, can be told apart from payloads.
+func sniffPayloads(msgs []inputMessage) bool {
+	for _, m := range msgs {
+		if _, err := m.detectSignal(); err != nil {
+			return false
+		}
+	}
+	return len(msgs) > 0
+}
+
+// inputMessage is one export request read from an input file, in OTLP
+// protobuf or OTLP JSON.
+type inputMessage struct {
+	data []byte
+	json bool
+}
+
+// readInputMessages splits an input file into export requests. It accepts:
+//
+//   - a raw ExportXServiceRequest protobuf, as the benchmark has always read;
+//   - OTLP JSON, one request or several concatenated, as the file exporter
+//     writes one per line;
+//   - the file exporter's framing, each request prefixed with its size as a
+//     4-byte big-endian integer and optionally zstd compressed;
+//   - any of those, gzip or zstd compressed as a whole.
+//
+// Containers are told apart by their content, not their extension.
+func readInputMessages(data []byte) ([]inputMessage, error) {
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		out, err := decompressBody("gzip", data)
+		if err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		return readInputMessages(out)
+	case bytes.HasPrefix(data, zstdMagic):
+		out, err := decompressBody("zstd", data)
+		if err != nil {
+			return nil, fmt.Errorf("zstd: %w", err)
+		}
+		return readInputMessages(out)
+	case isJSON(data):
+		return splitJSON(data)
+	}
+
+	frames, ok := splitFrames(data)
+	if !ok {
+		return []inputMessage{{data: data}}, nil
+	}
+	msgs := make([]inputMessage, len(frames))
+	for i, frame := range frames {
+		if bytes.HasPrefix(frame, zstdMagic) {
+			out, err := decompressBody("zstd", frame)
+			if err != nil {
+				return nil, fmt.Errorf("zstd frame %d: %w", i+1, err)
+			}
+			frame = out
+		}
+		msgs[i] = inputMessage{data: frame, json: isJSON(frame)}
+	}
+	return msgs, nil
+}
+
+// isJSON reports whether data starts like a JSON object. An OTLP protobuf
+// request starts with the tag of its first field, 0x0a.
+func isJSON(data []byte) bool {
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '{'
+}
+
+// splitJSON returns every JSON value in data, whether on separate lines or
+// one pretty-printed document.
+func splitJSON(data []byte) ([]inputMessage, error) {
+	var msgs []inputMessage
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				return msgs, nil
+			}
+			return nil, fmt.Errorf("JSON request %d: %w", len(msgs)+1, err)
+		}
+		msgs = append(msgs, inputMessage{data: raw, json: true})
+	}
+}
+
+// splitFrames splits size-prefixed framing. It fails unless the frames
+// cover data exactly, which a raw protobuf request practically never does:
+// its leading 0x0a would announce a frame of over 160MB.
+func splitFrames(data []byte) ([][]byte, bool) {
+	var frames [][]byte
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, false
+		}
+		n := binary.BigEndian.Uint32(data)
+		if n == 0 || uint64(n) > uint64(len(data)-4) {
+			return nil, false
+		}
+		frames = append(frames, data[4:4+n])
+		data = data[4+n:]
+	}
+	return frames, len(frames) > 0
+}
+
+// detectJSONSignal tells the signal of an OTLP JSON request from its
+// top-level field.
+func detectJSONSignal(data []byte) (signal, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return "", err
+	}
+	for key, sig := range map[string]signal{
+		"resourceMetrics":   signalMetrics,
+		"resource_metrics":  signalMetrics,
+		"resourceLogs":      signalLogs,
+		"resource_logs":     signalLogs,
+		"resourceSpans":     signalTraces,
+		"resource_spans":    signalTraces,
+		"resourceProfiles":  signalProfiles,
+		"resource_profiles": signalProfiles,
+	} {
+		if _, ok := fields[key]; ok {
+			return sig, nil
+		}
+	}
+	return "", errors.New("cannot detect signal type of JSON request, set --signal explicitly")
+}
+
+// detectSignal detects the signal of the message.
+func (m inputMessage) detectSignal() (signal, error) {
+	if m.json {
+		return detectJSONSignal(m.data)
+	}
+	return detectSignal(m.data)
+}
+
+// payload decodes the message. JSON requests are re-marshaled, so that raw
+// is always the protobuf size that ratios are measured against.
+func (m inputMessage) payload(sig signal, filename string) (payload, error) {
+	if !m.json {
+		return unmarshalPayload(sig, filename, m.data)
+	}
+	p, err := decodeRequest(sig, m.data, true)
+	if err != nil {
+		return payload{}, err
+	}
+	p.filename = filename
+	p.raw, err = p.marshalProto()
+	return p, err
+}
+
+// loadPayloads reads every payload file in dir as export requests of the
+// given signal. Files holding several requests, such as file exporter
+// output, yield one payload each, named file:N. With signalAuto the signal
+// is detected from the requests, which must all agree.
+func loadPayloads(dir string, sig signal) ([]payload, int64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, 0, fmt.Errorf("reading %s: %w", dir, err)
+	}
+
+	var requests []namedMessage
+	for _, e := range entries {
+		if e.IsDir() || !isInputFile(e.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, 0, fmt.Errorf("reading %s: %w", path, err)
+		}
+		msgs, err := readInputMessages(data)
+		if hasNoExtension(e.Name()) && (err != nil || !sniffPayloads(msgs)) {
+			fmt.Fprintf(os.Stderr, "skipping %s: not an OTLP payload\n", path)
+			continue
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", path, err)
+		}
+
+		for i, m := range msgs {
+			name := e.Name()
+			if len(msgs) > 1 {
+				name = fmt.Sprintf("%s:%d", name, i+1)
+			}
+			requests = append(requests, namedMessage{inputMessage: m, name: name, path: path})
+		}
+	}
+	if len(requests) == 0 {
+		return nil, 0, fmt.Errorf("no payload files found in %s", dir)
+	}
+
+	if sig == signalAuto {
+		if sig, err = agreedSignal(requests); err != nil {
+			return nil, 0, err
+		}
+	}
+	var payloads []payload
+	var totalRawBytes int64
+	for _, m := range requests {
+		p, err := m.payload(sig, m.name)
+		if err != nil {
+			return nil, 0, fmt.Errorf("unmarshaling %s: %w", m.name, err)
+		}
+		payloads = append(payloads, p)
+		totalRawBytes += int64(len(p.raw))
+	}
+	return payloads, totalRawBytes, nil
+}
+
+// namedMessage is an input request with the payload name it gets and the
+// file it came from.
+type namedMessage struct {
+	inputMessage
+	name string
+	path string
+}
+
+// agreedSignal detects the signal of every request and checks that they
+// agree. Requests without items, such as the empty export requests that
+// captured traffic often holds, fit any signal, so they take the signal of
+// the others; only a directory with no detectable request fails.
+func agreedSignal(requests []namedMessage) (signal, error) {
+	var sig signal
+	var detectedIn string
+	var firstErr error
+	for _, m := range requests {
+		got, err := m.detectSignal()
+		switch {
+		case err != nil:
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", m.path, err)
+			}
+		case sig == "":
+			sig, detectedIn = got, m.name
+		case got != sig:
+			return "", fmt.Errorf("%s holds %s, but %s holds %s; set --signal or split the directory",
+				detectedIn, sig, m.name, got)
+		}
+	}
+	if sig == "" {
+		return "", firstErr
+	}
+	return sig, nil
+}
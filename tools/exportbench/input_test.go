@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+)
+
+func TestLoadPayloadsInputFormats(t *testing.T) {
+	cfg := defaultSyntheticConfig()
+	payloads, _, err := generatePayloads(cfg, signalMetrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := payloads[0].metrics
+	pb, err := req.MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	js, err := req.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pretty bytes.Buffer
+	pretty.WriteString("{\n  ")
+	pretty.Write(js[1:])
+
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer enc.Close()
+	frame := func(b []byte) []byte {
+		return append(binary.BigEndian.AppendUint32(nil, uint32(len(b))), b...)
+	}
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(pb)
+	zw.Close()
+	jsonl := append(append(append([]byte{}, js...), '\n'), append(js, '\n')...)
+
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"a.pb":        pb,
+		"b.json":      pretty.Bytes(),
+		"c.jsonl":     jsonl,
+		"d.proto":     append(frame(pb), frame(enc.EncodeAll(pb, nil))...),
+		"e.pb.gz":     gz.Bytes(),
+		"f.jsonl.zst": enc.EncodeAll(jsonl, nil),
+		"README.md":   []byte("# not a payload\n"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, total, err := loadPayloads(dir, signalAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a.pb", "b.json", "c.jsonl:1", "c.jsonl:2", "d.proto:1", "d.proto:2", "e.pb.gz", "f.jsonl.zst:1", "f.jsonl.zst:2"}
+	if len(got) != len(want) {
+		t.Fatalf("loaded %d payloads, want %d", len(got), len(want))
+	}
+	for i, p := range got {
+		if p.filename != want[i] {
+			t.Errorf("payload %d is %q, want %q", i, p.filename, want[i])
+		}
+		if p.signal != signalMetrics || p.itemCount() != payloads[0].itemCount() {
+			t.Errorf("%s: %s with %d items, want metrics with %d", p.filename, p.signal, p.itemCount(), payloads[0].itemCount())
+		}
+		// Ratios are measured against the protobuf size, whatever the input.
+		if !bytes.Equal(p.raw, pb) {
+			t.Errorf("%s: raw is %d bytes, want the %d byte protobuf", p.filename, len(p.raw), len(pb))
+		}
+	}
+	if total != int64(len(want)*len(pb)) {
+		t.Errorf("total raw bytes = %d, want %d", total, len(want)*len(pb))
+	}
+
+	if _, _, err := loadPayloads(t.TempDir(), signalAuto); err == nil {
+		t.Error("empty directory loaded without error")
+	}
+}
+
+func TestLoadPayloadsMixedSignals(t *testing.T) {
+	cfg := defaultSyntheticConfig()
+	cfg.files = 1
+	dir := t.TempDir()
+	for name, sig := range map[string]signal{"a.pb": signalMetrics, "b.pb": signalLogs} {
+		payloads, _, err := generatePayloads(cfg, sig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), payloads[0].raw, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, _, err := loadPayloads(dir, signalAuto)
+	if err == nil || !strings.Contains(err.Error(), "a.pb holds metrics, but b.pb holds logs") {
+		t.Errorf("loadPayloads = %v, want a mixed signals error", err)
+	}
+}
+
+func TestLoadPayloadsEmptyRequests(t *testing.T) {
+	cfg := defaultSyntheticConfig()
+	cfg.files = 1
+	payloads, _, err := generatePayloads(cfg, signalMetrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	// An empty export request encodes to no bytes at all, and sorts
+	// before the request that tells the signal.
+	for name, data := range map[string][]byte{"a.pb": {}, "b.pb": payloads[0].raw} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, _, err := loadPayloads(dir, signalAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].filename != "a.pb" || got[0].signal != signalMetrics || got[0].itemCount() != 0 {
+		t.Errorf("loaded %d payloads, want the empty a.pb as metrics before b.pb", len(got))
+	}
+
+	if err := os.Remove(filepath.Join(dir, "b.pb")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := loadPayloads(dir, signalAuto); err == nil {
+		t.Error("loaded a directory of empty requests without a signal")
+	}
+}
+
+func TestLoadPayloadsSkipsNonPayloads(t *testing.T) {
+	cfg := defaultSyntheticConfig()
+	cfg.files = 1
+	payloads, _, err := generatePayloads(cfg, signalMetrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{
+		"0000":    payloads[0].raw,
+		"LICENSE": []byte("Apache License\nVersion 2.0, January 2004\n"),
+		"README":  []byte("# Captured payloads\n"),
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, _, err := loadPayloads(dir, signalAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].filename != "0000" {
+		t.Errorf("loaded %d payloads, want only 0000", len(got))
+	}
+}
+
+func TestDetectJSONSignal(t *testing.T) {
+	js, err := pmetricotlp.NewExportRequest().MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An empty request has no fields to tell the signal by.
+	if _, err := detectJSONSignal(js); err == nil {
+		t.Errorf("detected a signal in %s", js)
+	}
+	if sig, err := detectJSONSignal([]byte(`{"resourceLogs":[]}`)); err != nil || sig != signalLogs {
+		t.Errorf("resourceLogs detected as %q, %v", sig, err)
+	}
+}
@@ -0,0 +1,455 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+// datasetStats describes the shape of a dataset: the properties that decide
+// how much the formats can gain from dictionaries, columnar layouts and
+// compression.
+type datasetStats struct {
+	Source    string `json:"source"`
+	Signal    signal `json:"signal"`
+	Files     int    `json:"files"`
+	RawBytes  int64  `json:"raw_bytes"`
+	Resources int64  `json:"resources"`
+	Scopes    int64  `json:"scopes"`
+	// Records are metrics, log records or spans.
+	Records int64 `json:"records"`
+	Items   int64 `json:"items"`
+	// Series are distinct metric name, resource and data point attribute
+	// combinations. Many points per series is what STEF's dictionaries and
+	// delta encoding feed on.
+	Series        int               `json:"series,omitempty"`
+	MetricNames   int               `json:"metric_names,omitempty"`
+	MetricTypes   []metricTypeStats `json:"metric_types,omitempty"`
+	Histograms    *bucketStats      `json:"histogram_buckets,omitempty"`
+	ExpHistograms *bucketStats      `json:"exponential_histogram_buckets,omitempty"`
+	Exemplars     int64             `json:"exemplars"`
+	Attributes    []attributeStats  `json:"attributes"`
+	Strings       stringStats       `json:"strings"`
+}
+
+type metricTypeStats struct {
+	Type       string `json:"type"`
+	Metrics    int64  `json:"metrics"`
+	DataPoints int64  `json:"data_points"`
+	Delta      int64  `json:"delta_metrics,omitempty"`
+	Cumulative int64  `json:"cumulative_metrics,omitempty"`
+}
+
+// bucketStats is the number of buckets per histogram data point.
+type bucketStats struct {
+	DataPoints int64   `json:"data_points"`
+	Min        int     `json:"min"`
+	Max        int     `json:"max"`
+	Mean       float64 `json:"mean"`
+}
+
+// attributeStats is one attribute key at one level (resource, scope, data
+// point, log record or span).
+type attributeStats struct {
+	Level       string `json:"level"`
+	Key         string `json:"key"`
+	Occurrences int64  `json:"occurrences"`
+	Distinct    int    `json:"distinct_values"`
+}
+
+// stringStats covers every string in the dataset: attribute keys and string
+// values, metric names, descriptions and units, scope names and versions,
+// log bodies and span names. RepeatedRatio is the share of string bytes
+// that repeat a string seen before, which a dictionary encodes only once.
+type stringStats struct {
+	Occurrences   int64   `json:"occurrences"`
+	Unique        int     `json:"unique"`
+	Bytes         int64   `json:"bytes"`
+	UniqueBytes   int64   `json:"unique_bytes"`
+	RepeatedRatio float64 `json:"repeated_ratio"`
+}
+
+// inspector accumulates datasetStats over payloads.
+type inspector struct {
+	stats       datasetStats
+	types       map[string]*metricTypeStats
+	metricNames map[string]struct{}
+	series      map[string]struct{}
+	hist, exp   bucketAccumulator
+	attrs       map[[2]string]*attributeAccumulator
+	strs        map[string]struct{}
+}
+
+type attributeAccumulator struct {
+	occurrences int64
+	values      map[string]struct{}
+}
+
+type bucketAccumulator struct {
+	points, total int64
+	min, max      int
+}
+
+func (b *bucketAccumulator) add(n int) {
+	if b.points == 0 || n < b.min {
+		b.min = n
+	}
+	b.max = max(b.max, n)
+	b.points++
+	b.total += int64(n)
+}
+
+func (b *bucketAccumulator) stats() *bucketStats {
+	if b.points == 0 {
+		return nil
+	}
+	return &bucketStats{DataPoints: b.points, Min: b.min, Max: b.max, Mean: float64(b.total) / float64(b.points)}
+}
+
+func newInspector() *inspector {
+	return &inspector{
+		types:       map[string]*metricTypeStats{},
+		metricNames: map[string]struct{}{},
+		series:      map[string]struct{}{},
+		attrs:       map[[2]string]*attributeAccumulator{},
+		strs:        map[string]struct{}{},
+	}
+}
+
+func (in *inspector) str(s string) {
+	in.stats.Strings.Occurrences++
+	in.stats.Strings.Bytes += int64(len(s))
+	if _, ok := in.strs[s]; !ok {
+		in.strs[s] = struct{}{}
+		in.stats.Strings.UniqueBytes += int64(len(s))
+	}
+}
+
+// attributes records m's keys and values at level and returns them in a
+// canonical form, for series identity.
+func (in *inspector) attributes(level string, m pcommon.Map) string {
+	pairs := make([]string, 0, m.Len())
+	for k, v := range m.All() {
+		in.str(k)
+		value := v.AsString()
+		if v.Type() == pcommon.ValueTypeStr {
+			in.str(value)
+		}
+		a, ok := in.attrs[[2]string{level, k}]
+		if !ok {
+			a = &attributeAccumulator{values: map[string]struct{}{}}
+			in.attrs[[2]string{level, k}] = a
+		}
+		a.occurrences++
+		a.values[value] = struct{}{}
+		pairs = append(pairs, k+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "\x00")
+}
+
+func (in *inspector) scope(s pcommon.InstrumentationScope) {
+	in.stats.Scopes++
+	in.str(s.Name())
+	in.str(s.Version())
+	in.attributes("scope", s.Attributes())
+}
+
+func (in *inspector) add(p payload) error {
+	in.stats.Files++
+	in.stats.RawBytes += int64(len(p.raw))
+	in.stats.Items += int64(p.itemCount())
+	switch p.signal {
+	case signalMetrics:
+		in.addMetrics(p.metrics.Metrics())
+	case signalLogs:
+		for _, rl := range p.logs.Logs().ResourceLogs().All() {
+			in.stats.Resources++
+			in.attributes("resource", rl.Resource().Attributes())
+			for _, sl := range rl.ScopeLogs().All() {
+				in.scope(sl.Scope())
+				for _, lr := range sl.LogRecords().All() {
+					in.stats.Records++
+					if lr.Body().Type() == pcommon.ValueTypeStr {
+						in.str(lr.Body().Str())
+					}
+					in.attributes("log record", lr.Attributes())
+				}
+			}
+		}
+	case signalTraces:
+		for _, rs := range p.traces.Traces().ResourceSpans().All() {
+			in.stats.Resources++
+			in.attributes("resource", rs.Resource().Attributes())
+			for _, ss := range rs.ScopeSpans().All() {
+				in.scope(ss.Scope())
+				for _, span := range ss.Spans().All() {
+					in.stats.Records++
+					in.str(span.Name())
+					in.attributes("span", span.Attributes())
+				}
+			}
+		}
+	default:
+		return fmt.Errorf("inspect does not support %s", p.signal)
+	}
+	return nil
+}
+
+func (in *inspector) addMetrics(md pmetric.Metrics) {
+	for _, rm := range md.ResourceMetrics().All() {
+		in.stats.Resources++
+		resource := in.attributes("resource", rm.Resource().Attributes())
+		for _, sm := range rm.ScopeMetrics().All() {
+			in.scope(sm.Scope())
+			for _, m := range sm.Metrics().All() {
+				in.stats.Records++
+				in.str(m.Name())
+				in.str(m.Description())
+				in.str(m.Unit())
+				in.metricNames[m.Name()] = struct{}{}
+
+				typ := metricTypeName(m.Type())
+				t, ok := in.types[typ]
+				if !ok {
+					t = &metricTypeStats{Type: typ}
+					in.types[typ] = t
+				}
+				t.Metrics++
+				var temporality pmetric.AggregationTemporality
+				point := func(attrs pcommon.Map, exemplars pmetric.ExemplarSlice) {
+					t.DataPoints++
+					in.stats.Exemplars += int64(exemplars.Len())
+					id := m.Name() + "\x01" + resource + "\x01" + in.attributes("data point", attrs)
+					in.series[id] = struct{}{}
+				}
+				switch m.Type() {
+				case pmetric.MetricTypeGauge:
+					for _, dp := range m.Gauge().DataPoints().All() {
+						point(dp.Attributes(), dp.Exemplars())
+					}
+				case pmetric.MetricTypeSum:
+					temporality = m.Sum().AggregationTemporality()
+					for _, dp := range m.Sum().DataPoints().All() {
+						point(dp.Attributes(), dp.Exemplars())
+					}
+				case pmetric.MetricTypeHistogram:
+					temporality = m.Histogram().AggregationTemporality()
+					for _, dp := range m.Histogram().DataPoints().All() {
+						point(dp.Attributes(), dp.Exemplars())
+						in.hist.add(dp.BucketCounts().Len())
+					}
+				case pmetric.MetricTypeExponentialHistogram:
+					temporality = m.ExponentialHistogram().AggregationTemporality()
+					for _, dp := range m.ExponentialHistogram().DataPoints().All() {
+						point(dp.Attributes(), dp.Exemplars())
+						in.exp.add(dp.Positive().BucketCounts().Len() + dp.Negative().BucketCounts().Len())
+					}
+				case pmetric.MetricTypeSummary:
+					for _, dp := range m.Summary().DataPoints().All() {
+						point(dp.Attributes(), pmetric.NewExemplarSlice())
+					}
+				}
+				switch temporality {
+				case pmetric.AggregationTemporalityDelta:
+					t.Delta++
+				case pmetric.AggregationTemporalityCumulative:
+					t.Cumulative++
+				}
+			}
+		}
+	}
+}
+
+func metricTypeName(t pmetric.MetricType) string {
+	switch t {
+	case pmetric.MetricTypeExponentialHistogram:
+		return "exponential histogram"
+	default:
+		return strings.ToLower(t.String())
+	}
+}
+
+// result finishes the stats, listing attribute keys by distinct values.
+func (in *inspector) result() datasetStats {
+	s := in.stats
+	s.Series = len(in.series)
+	s.MetricNames = len(in.metricNames)
+	for _, t := range in.types {
+		s.MetricTypes = append(s.MetricTypes, *t)
+	}
+	slices.SortFunc(s.MetricTypes, func(a, b metricTypeStats) int {
+		if c := cmp.Compare(b.DataPoints, a.DataPoints); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Type, b.Type)
+	})
+	s.Histograms = in.hist.stats()
+	s.ExpHistograms = in.exp.stats()
+	s.Attributes = []attributeStats{}
+	for k, a := range in.attrs {
+		s.Attributes = append(s.Attributes, attributeStats{
+			Level:       k[0],
+			Key:         k[1],
+			Occurrences: a.occurrences,
+			Distinct:    len(a.values),
+		})
+	}
+	slices.SortFunc(s.Attributes, func(a, b attributeStats) int {
+		if c := cmp.Compare(b.Distinct, a.Distinct); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(b.Occurrences, a.Occurrences); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Level+a.Key, b.Level+b.Key)
+	})
+	s.Strings.Unique = len(in.strs)
+	if s.Strings.Bytes > 0 {
+		s.Strings.RepeatedRatio = 1 - float64(s.Strings.UniqueBytes)/float64(s.Strings.Bytes)
+	}
+	return s
+}
+
+func inspectPayloads(payloads []payload) (datasetStats, error) {
+	in := newInspector()
+	for _, p := range payloads {
+		if err := in.add(p); err != nil {
+			return datasetStats{}, err
+		}
+	}
+	return in.result(), nil
+}
+
+// runInspect implements the inspect subcommand, which describes a dataset
+// without benchmarking it.
+func runInspect(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	inputDir := fs.String("input-dir", "", "directory of OTLP payloads, as for the benchmark (required unless --synthetic)")
+	signalName := fs.String("signal", string(signalAuto), "signal type of the payloads: auto, metrics, logs or traces")
+	synthetic := fs.Bool("synthetic", false, "inspect generated payloads instead of --input-dir")
+	outputFormat := fs.String("output-format", "markdown", "result format: markdown or json")
+	top := fs.Int("top", 20, "number of attribute keys to list, by distinct values")
+	var cfg syntheticConfig
+	cfg.registerFlags(fs)
+	fs.Parse(args)
+
+	sig, err := parseSignal(*signalName)
+	if err != nil {
+		return err
+	}
+	var payloads []payload
+	source := *inputDir
+	switch {
+	case *synthetic:
+		if sig == signalAuto {
+			sig = signalMetrics
+		}
+		payloads, _, err = generatePayloads(cfg, sig)
+		source = fmt.Sprintf("synthetic (seed %d)", cfg.seed)
+	case *inputDir != "":
+		payloads, _, err = loadPayloads(*inputDir, sig)
+	default:
+		fs.Usage()
+		return errors.New("--input-dir or --synthetic is required")
+	}
+	if err != nil {
+		return err
+	}
+
+	stats, err := inspectPayloads(payloads)
+	if err != nil {
+		return err
+	}
+	stats.Source = source
+	stats.Signal = payloads[0].signal
+	switch *outputFormat {
+	case "markdown":
+		return writeInspectMarkdown(os.Stdout, stats, *top)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(stats)
+	default:
+		return fmt.Errorf("unknown --output-format %q", *outputFormat)
+	}
+}
+
+func writeInspectMarkdown(w io.Writer, s datasetStats, top int) error {
+	perFile := func(n int64) float64 { return float64(n) / float64(max(s.Files, 1)) }
+	fmt.Fprintln(w, "## Dataset")
+	fmt.Fprintf(w, "- Source: %s\n", s.Source)
+	fmt.Fprintf(w, "- Files: %d (%.1f MB raw)\n", s.Files, float64(s.RawBytes)/1024/1024)
+	fmt.Fprintf(w, "- Signal: %s\n", s.Signal)
+	fmt.Fprintf(w, "- Resources: %d (%.1f per file)\n", s.Resources, perFile(s.Resources))
+	fmt.Fprintf(w, "- Scopes: %d (%.1f per resource)\n", s.Scopes, float64(s.Scopes)/float64(max(s.Resources, 1)))
+	fmt.Fprintf(w, "- Records: %d (%.1f per scope)\n", s.Records, float64(s.Records)/float64(max(s.Scopes, 1)))
+	fmt.Fprintf(w, "- %s: %d (%.1f per file, %.1f raw bytes each)\n",
+		s.Signal.itemName(), s.Items, perFile(s.Items), float64(s.RawBytes)/float64(max(s.Items, 1)))
+	if s.Signal == signalMetrics {
+		fmt.Fprintf(w, "- Metric names: %d\n", s.MetricNames)
+		fmt.Fprintf(w, "- Series: %d (%.1f data points each)\n", s.Series, float64(s.Items)/float64(max(s.Series, 1)))
+		fmt.Fprintf(w, "- Exemplars: %d\n", s.Exemplars)
+	}
+
+	if len(s.MetricTypes) > 0 {
+		fmt.Fprintf(w, "\n## Metric types\n\n")
+		fmt.Fprintln(w, "| Type | Metrics | Data points | Share | Delta | Cumulative |")
+		fmt.Fprintln(w, "|------|---------|-------------|-------|-------|------------|")
+		for _, t := range s.MetricTypes {
+			fmt.Fprintf(w, "| %s | %d | %d | %.1f%% | %d | %d |\n",
+				t.Type, t.Metrics, t.DataPoints, float64(t.DataPoints)/float64(max(s.Items, 1))*100, t.Delta, t.Cumulative)
+		}
+	}
+	if s.Histograms != nil || s.ExpHistograms != nil {
+		fmt.Fprintf(w, "\n## Histogram buckets per data point\n\n")
+		fmt.Fprintln(w, "| Type | Data points | Min | Mean | Max |")
+		fmt.Fprintln(w, "|------|-------------|-----|------|-----|")
+		for _, b := range []struct {
+			name string
+			s    *bucketStats
+		}{{"histogram", s.Histograms}, {"exponential histogram", s.ExpHistograms}} {
+			if b.s != nil {
+				fmt.Fprintf(w, "| %s | %d | %d | %.1f | %d |\n", b.name, b.s.DataPoints, b.s.Min, b.s.Mean, b.s.Max)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "\n## Strings\n\n")
+	fmt.Fprintf(w, "- Occurrences: %d, unique: %d\n", s.Strings.Occurrences, s.Strings.Unique)
+	fmt.Fprintf(w, "- Bytes: %.1f MB, unique: %.1f MB\n", float64(s.Strings.Bytes)/1024/1024, float64(s.Strings.UniqueBytes)/1024/1024)
+	fmt.Fprintf(w, "- Repeated string ratio: %.1f%%\n", s.Strings.RepeatedRatio*100)
+
+	levels := map[string]int{}
+	for _, a := range s.Attributes {
+		levels[a.Level]++
+	}
+	fmt.Fprintf(w, "\n## Attribute keys\n\n")
+	for _, level := range []string{"resource", "scope", "data point", "log record", "span"} {
+		if n := levels[level]; n > 0 {
+			fmt.Fprintf(w, "- %s: %d keys\n", level, n)
+		}
+	}
+	fmt.Fprintf(w, "\n| Level | Key | Occurrences | Distinct values |\n")
+	fmt.Fprintln(w, "|-------|-----|-------------|-----------------|")
+	for i, a := range s.Attributes {
+		if i == top {
+			fmt.Fprintf(w, "\n%d more keys not shown; see --top.\n", len(s.Attributes)-top)
+			break
+		}
+		if _, err := fmt.Fprintf(w, "| %s | %s | %d | %d |\n", a.Level, a.Key, a.Occurrences, a.Distinct); err != nil {
+			return err
+		}
+	}
+	return nil
+}
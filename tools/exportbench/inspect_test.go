@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+)
+
+func TestInspectMetrics(t *testing.T) {
+	md := pmetric.NewMetrics()
+	rm := md.ResourceMetrics().AppendEmpty()
+	rm.Resource().Attributes().PutStr("service.name", "checkout")
+	sm := rm.ScopeMetrics().AppendEmpty()
+	sm.Scope().SetName("meter")
+
+	sum := sm.Metrics().AppendEmpty()
+	sum.SetName("requests")
+	sum.SetEmptySum().SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+	for _, route := range []string{"/a", "/b", "/a"} {
+		dp := sum.Sum().DataPoints().AppendEmpty()
+		dp.Attributes().PutStr("route", route)
+	}
+	hist := sm.Metrics().AppendEmpty()
+	hist.SetName("latency")
+	hist.SetEmptyHistogram().SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+	for _, buckets := range []int{3, 5} {
+		dp := hist.Histogram().DataPoints().AppendEmpty()
+		dp.BucketCounts().FromRaw(make([]uint64, buckets))
+		dp.Exemplars().AppendEmpty()
+	}
+
+	req := pmetricotlp.NewExportRequestFromMetrics(md)
+	raw, err := req.MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := inspectPayloads([]payload{{filename: "a.pb", raw: raw, signal: signalMetrics, metrics: req}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Resources != 1 || stats.Scopes != 1 || stats.Records != 2 || stats.Items != 5 {
+		t.Errorf("counts = %d resources, %d scopes, %d records, %d items", stats.Resources, stats.Scopes, stats.Records, stats.Items)
+	}
+	// The two /a points belong to one series.
+	if stats.Series != 3 || stats.MetricNames != 2 || stats.Exemplars != 2 {
+		t.Errorf("%d series, %d names, %d exemplars, want 3, 2 and 2", stats.Series, stats.MetricNames, stats.Exemplars)
+	}
+	if len(stats.MetricTypes) != 2 || stats.MetricTypes[0] != (metricTypeStats{Type: "sum", Metrics: 1, DataPoints: 3, Delta: 1}) {
+		t.Errorf("metric types = %+v", stats.MetricTypes)
+	}
+	if h := stats.Histograms; h == nil || h.Min != 3 || h.Max != 5 || h.Mean != 4 {
+		t.Errorf("histogram buckets = %+v", h)
+	}
+	if a := stats.Attributes[0]; a != (attributeStats{Level: "data point", Key: "route", Occurrences: 3, Distinct: 2}) {
+		t.Errorf("top attribute = %+v", a)
+	}
+	if stats.Strings.RepeatedRatio <= 0 || stats.Strings.Unique >= int(stats.Strings.Occurrences) {
+		t.Errorf("strings = %+v, want repeats", stats.Strings)
+	}
+
+	var buf bytes.Buffer
+	if err := writeInspectMarkdown(&buf, stats, 1); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "| data point | route | 3 | 2 |") || !strings.Contains(buf.String(), "1 more keys") {
+		t.Errorf("markdown:\n%s", buf.String())
+	}
+}
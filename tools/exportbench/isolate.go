@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+)
+
+// isolatedResult is what one child process reported for its format.
+type isolatedResult struct {
+	record  resultRecord
+	files   []fileRecord
+	peakRSS int64
+}
+
+// runIsolated benchmarks every format in a child process of its own: the
+// same binary with the same arguments, narrowed to the format with --format
+// and reporting JSON on stdout. A child starts with a fresh heap and GC
+// state, and nothing an earlier exporter left running can skew it. The
+// children's progress and warnings go to stderr as usual.
+func runIsolated(names, args []string) ([]isolatedResult, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	results := make([]isolatedResult, 0, len(names))
+	for _, name := range names {
+		childArgs := append(slices.Clone(args),
+			"--isolate=false", "--format", name, "--output-format", "json", "--output-file", "")
+		cmd := exec.Command(exe, childArgs...)
+		var stdout bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("%s: child process: %w", name, err)
+		}
+
+		var rep report
+		if err := json.Unmarshal(stdout.Bytes(), &rep); err != nil {
+			return nil, fmt.Errorf("%s: reading child report: %w", name, err)
+		}
+		if len(rep.Results) != 1 {
+			return nil, fmt.Errorf("%s: child reported %d results, want 1", name, len(rep.Results))
+		}
+		results = append(results, isolatedResult{
+			record:  rep.Results[0],
+			files:   rep.Files,
+			peakRSS: peakRSS(cmd.ProcessState),
+		})
+	}
+	return results, nil
+}
+
+// mergeIsolated puts the children's results into one report, in format
+// order, and joins their per-file sizes.
+func mergeIsolated(r *report, results []isolatedResult) {
+	r.Isolated = true
+	r.Results = r.Results[:0]
+	names := make([]string, 0, len(results))
+	for _, res := range results {
+		rec := res.record
+		rec.PeakRSSBytes = res.peakRSS
+		r.Results = append(r.Results, rec)
+		names = append(names, rec.Format)
+	}
+
+	if len(results) == 0 || len(results[0].files) == 0 {
+		return
+	}
+	r.Files = slices.Clone(results[0].files)
+	for i := range r.Files {
+		wire := map[string]int64{}
+		var dropped []string
+		for _, res := range results {
+			if i < len(res.files) {
+				for name, size := range res.files[i].WireBytes {
+					wire[name] = size
+				}
+				dropped = append(dropped, res.files[i].Dropped...)
+			}
+		}
+		r.Files[i].WireBytes = wire
+		r.Files[i].Dropped = dropped
+		r.Files[i].pickBest(names)
+	}
+}
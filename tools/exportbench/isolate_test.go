@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestMergeIsolated(t *testing.T) {
+	files := func(name string, sizes ...int64) []fileRecord {
+		recs := make([]fileRecord, len(sizes))
+		for i, size := range sizes {
+			recs[i] = fileRecord{File: "f", RawBytes: 1000, WireBytes: map[string]int64{name: size}}
+			recs[i].pickBest([]string{name})
+		}
+		return recs
+	}
+	results := []isolatedResult{
+		{record: resultRecord{Format: "X"}, files: files("X", 500, 400), peakRSS: 100 << 20},
+		{record: resultRecord{Format: "Y"}, files: files("Y", 250, 800), peakRSS: 80 << 20},
+		// Z dropped the first file's items under --faults.
+		{record: resultRecord{Format: "Z"}, files: []fileRecord{
+			{File: "f", RawBytes: 1000, WireBytes: map[string]int64{}, Dropped: []string{"Z"}},
+			{File: "f", RawBytes: 1000, WireBytes: map[string]int64{"Z": 900}},
+		}},
+	}
+	var r report
+	mergeIsolated(&r, results)
+
+	if !r.Isolated || len(r.Results) != 3 || r.Results[0].Format != "X" || r.Results[1].PeakRSSBytes != 80<<20 {
+		t.Errorf("results = %+v", r.Results)
+	}
+	if len(r.Files) != 2 {
+		t.Fatalf("%d files, want 2", len(r.Files))
+	}
+	if f := r.Files[0]; f.BestFormat != "Y" || f.BestRatio != 4 || f.WireBytes["X"] != 500 {
+		t.Errorf("file 0 = %+v, want Y at 4x", f)
+	}
+	if f := r.Files[0]; len(f.Dropped) != 1 || f.Dropped[0] != "Z" {
+		t.Errorf("file 0 dropped by %v, want Z", f.Dropped)
+	}
+	if f := r.Files[1]; f.BestFormat != "X" || f.WireBytes["Y"] != 800 {
+		t.Errorf("file 1 = %+v, want X", f)
+	}
+	// The first child's records must not be modified.
+	if len(results[0].files[0].WireBytes) != 1 {
+		t.Error("merging modified a child's file records")
+	}
+}
+
+func TestSelectFormat(t *testing.T) {
+	formats := []benchFormat{{name: "A"}, {name: "B"}}
+	got, err := selectFormat(formats, "B")
+	if err != nil || len(got) != 1 || got[0].name != "B" {
+		t.Errorf("selectFormat(B) = %v, %v", got, err)
+	}
+	if _, err := selectFormat(formats, "C"); err == nil {
+		t.Error("selectFormat(C) found a format")
+	}
+	if got, err := selectFormatName([]string{"OTLP gRPC", "STEF (zstd)"}, "STEF_zstd"); err != nil || got != "STEF (zstd)" {
+		t.Errorf("selectFormatName(STEF_zstd) = %q, %v", got, err)
+	}
+}
@@ -5,322 +5,804 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"path/filepath"
 	"runtime"
-	"sort"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/component/componenttest"
-	"go.opentelemetry.io/collector/config/configcompression"
 	"go.opentelemetry.io/collector/config/configoptional"
-	"go.opentelemetry.io/collector/config/configretry"
-	"go.opentelemetry.io/collector/config/configtls"
 	"go.opentelemetry.io/collector/exporter"
 	"go.opentelemetry.io/collector/exporter/exporterhelper"
 	"go.opentelemetry.io/collector/exporter/exportertest"
 	"go.opentelemetry.io/collector/exporter/otlpexporter"
 	"go.opentelemetry.io/collector/exporter/otlphttpexporter"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
 	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.opentelemetry.io/collector/pdata/pprofile/pprofileotlp"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
 
+	"github.com/open-telemetry/opentelemetry-collector-contrib/exporter/otelarrowexporter"
 	"github.com/open-telemetry/opentelemetry-collector-contrib/exporter/stefexporter"
 )
 
 type payload struct {
 	filename string
 	raw      []byte
-	req      pmetricotlp.ExportRequest
+	signal   signal
+	metrics  pmetricotlp.ExportRequest
+	logs     plogotlp.ExportRequest
+	traces   ptraceotlp.ExportRequest
+	profiles pprofileotlp.ExportRequest
 }
 
 type formatResult struct {
-	name          string
-	totalBytes    int64
+	name       string
+	codec      codec
+	totalBytes int64
+	// socket is what crossed the server's sockets in the iteration that
+	// totalBytes was measured in.
+	socket        socketBytes
 	serializeTime time.Duration
 	allocBytes    int64
 	numAllocs     int64
+	samples       []iterationSample
+	// decode is the server-side decode cost per iteration, set only in
+	// --decode mode.
+	decode *decodeResult
+	// verify is the round-trip check, set only in --verify mode.
+	verify *verification
+	// delivery is how the format coped with a degraded downstream, set
+	// only with --faults.
+	delivery *deliveryResult
+	// allocs summarizes the sampled allocations of all timed iterations,
+	// set only with --memprofile-dir.
+	allocs *allocProfile
+	// fileBytes is the wire size of each payload exported on its own, set
+	// only with --per-file.
+	fileBytes []int64
+	// replay is the cost at a fixed offered load, set only with --replay.
+	replay *replayResult
+	// soak is the long run and leak check, set only with --duration.
+	soak *soakResult
+	// memory is the high-water marks and GC activity of the timed
+	// iterations.
+	memory memoryPeaks
+}
+
+// iterationSample is the cost of one timed export of the whole dataset.
+type iterationSample struct {
+	elapsed    time.Duration
+	cpu        time.Duration
+	allocs     int64
+	allocBytes int64
+	decode     decodeStats
+	delivery   deliveryStats
 }
 
 type benchFormat struct {
-	name    string
-	setup   func() error
-	export  func([]payload) error
-	size    func() int64
-	cleanup func()
+	name   string
+	codec  codec
+	setup  func() error
+	export func([]payload) error
+	size   func() int64
+	// socket reports the bytes that crossed the server's sockets since the
+	// last call, framing and TLS included.
+	socket func() socketBytes
+	// openConns reports the server's connections currently open, for the
+	// leak check after a --duration soak.
+	openConns func() int64
+	decoded   func() decodeStats
+	// delivery reports retries, drops and injected faults since the last
+	// call, for --faults.
+	delivery func() deliveryStats
+	cleanup  func()
+	// capture collects what the format's server decoded, for --verify.
+	capture *captureSink
+	// regroups marks exporters that regroup and reorder items across
+	// requests, so --verify matches items rather than whole requests.
+	regroups bool
 }
 
 func main() {
-	inputDir := flag.String("input-dir", "", "directory containing .pb files (required)")
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "generate":
+			if err := runGenerate(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "compare":
+			if err := runCompare(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(compareExitCode(err))
+			}
+			return
+		case "inspect":
+			if err := runInspect(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "capture":
+			if err := runCapture(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	inputDir := flag.String("input-dir", "", "directory of OTLP payloads: .pb, .json, .jsonl or file exporter output, optionally gzip or zstd compressed (required unless --synthetic)")
 	iterations := flag.Int("iterations", 10, "number of iterations for timing")
+	signalName := flag.String("signal", string(signalAuto), "signal type of the payloads: auto, metrics, logs, traces or profiles")
+	synthetic := flag.Bool("synthetic", false, "benchmark generated payloads instead of --input-dir")
+	outputFormat := flag.String("output-format", "markdown", "result format: markdown, json or csv")
+	outputFile := flag.String("output-file", "", "write results to this file instead of stdout")
+	cvWarn := flag.Float64("cv-warn", 0.10, "warn when the serialize time coefficient of variation exceeds this")
+	concurrency := flag.Int("concurrency", 1, "number of goroutines sharing one exporter, each sending a share of the payloads")
+	codecList := flag.String("codecs", defaultCodecs, "comma-separated compression codecs to benchmark: none, gzip, zlib, deflate, snappy, lz4, zstd, with an optional :level")
+	decode := flag.Bool("decode", false, "make the servers unmarshal every request into pdata and report the server-side cost separately")
+	verify := flag.Bool("verify", false, "check that every format delivers the payloads intact; implies --decode")
+	queueName := flag.String("queue", "none", "exporterhelper sending_queue for every format: none, memory or file (persistent, via file_storage)")
+	batchSpec := flag.String("batch", "none", "sending_queue batching: none, items:N or bytes:N for a minimum batch size; implies --queue memory")
+	faultSpec := flag.String("faults", "", "degrade the nop servers, e.g. latency=20ms,bandwidth=10MiB,errors=0.05,resets=0.01,ack-delay=100ms,ack-withhold=0.1")
+	retryInterval := flag.Duration("retry", 0, "enable retry_on_failure for the built-in formats with this initial interval; 0 keeps retries off")
+	cpuProfileDir := flag.String("cpuprofile-dir", "", "write a CPU profile of each format's timed iterations to this directory")
+	memProfileDir := flag.String("memprofile-dir", "", "write an allocation profile of each format's timed iterations to this directory, and report the top allocation sites")
+	perFile := flag.Bool("per-file", false, "also export each file on its own and report its wire size per format and the best format for it")
+	useTLS := flag.Bool("tls", false, "serve the nop servers over TLS with a locally generated certificate")
+	replaySpec := flag.String("replay", "", "after the timed iterations, also replay the payloads at a fixed load and measure steady-state CPU, memory and latency: recorded[:SPEED] (their own timestamps), items:N or bytes:SIZE per second")
+	soakDuration := flag.Duration("duration", 0, "after the timed iterations, keep exporting for this long while sampling heap, goroutines and open fds, then check for leaks after Shutdown")
+	isolate := flag.Bool("isolate", false, "benchmark each format in a child process of its own and merge the results, with each child's peak RSS")
+	formatName := flag.String("format", "", "benchmark only the format with this name, as shown in the results, or its key, e.g. STEF_zstd")
+	scenarioFile := flag.String("scenario", "", "YAML file of named exporter configurations to benchmark instead of the built-in formats")
+	var synthCfg syntheticConfig
+	synthCfg.registerFlags(flag.CommandLine)
 	flag.Parse()
 
-	if *inputDir == "" {
-		fmt.Fprintf(os.Stderr, "error: --input-dir is required\n")
+	sig, err := parseSignal(*signalName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	payloads, totalRawBytes, err := loadPayloads(*inputDir)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "error loading payloads: %v\n", err)
+	switch *outputFormat {
+	case "markdown", "json", "csv":
+	default:
+		fmt.Fprintf(os.Stderr, "error: unknown --output-format %q\n", *outputFormat)
+		flag.Usage()
 		os.Exit(1)
 	}
 
-	totalDataPoints := 0
-	for _, p := range payloads {
-		totalDataPoints += p.req.Metrics().DataPointCount()
+	codecs, err := parseCodecs(*codecList)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: --codecs: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
 	}
 
-	fmt.Println("## Dataset")
-	fmt.Printf("- Files: %d\n", len(payloads))
-	fmt.Printf("- Total raw protobuf: %.1f MB\n", float64(totalRawBytes)/1024/1024)
-	fmt.Printf("- Total data points: %d\n", totalDataPoints)
-	fmt.Println()
+	queue, err := parseQueueMode(*queueName, *batchSpec, *retryInterval)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: --queue/--batch/--retry: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
 
-	// Start nop servers for exporters to send to.
-	grpcSrv, err := startGRPCServer()
+	faults, err := parseFaults(*faultSpec)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error starting gRPC server: %v\n", err)
+		fmt.Fprintf(os.Stderr, "error: --faults: %v\n", err)
+		flag.Usage()
 		os.Exit(1)
 	}
-	defer grpcSrv.Stop()
 
-	httpSrv, err := startHTTPServer()
+	replay, err := parseReplayMode(*replaySpec)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error starting HTTP server: %v\n", err)
+		fmt.Fprintf(os.Stderr, "error: --replay: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var sc scenario
+	if *scenarioFile != "" {
+		sc, err = loadScenario(*scenarioFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: --scenario: %v\n", err)
+			os.Exit(1)
+		}
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "codecs", "queue", "batch", "retry":
+				fmt.Fprintf(os.Stderr, "warning: --%s is ignored with --scenario\n", f.Name)
+			}
+		})
+	}
+
+	profiles := profileDirs{cpu: *cpuProfileDir, mem: *memProfileDir}
+	for _, dir := range []string{profiles.cpu, profiles.mem} {
+		if dir == "" {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			fmt.Fprintf(os.Stderr, "error creating profile directory: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *concurrency < 1 {
+		fmt.Fprintf(os.Stderr, "error: --concurrency must be at least 1\n")
+		flag.Usage()
 		os.Exit(1)
 	}
-	defer httpSrv.Stop()
 
-	stefSrv, err := startSTEFServer()
+	// The servers can only capture what they decode.
+	if *verify {
+		*decode = true
+	}
+
+	if *inputDir == "" && !*synthetic {
+		fmt.Fprintf(os.Stderr, "error: --input-dir or --synthetic is required\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var payloads []payload
+	var totalRawBytes int64
+	if *synthetic {
+		if sig == signalAuto {
+			sig = signalMetrics
+		}
+		payloads, totalRawBytes, err = generatePayloads(synthCfg, sig)
+	} else {
+		payloads, totalRawBytes, err = loadPayloads(*inputDir, sig)
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error starting STEF server: %v\n", err)
+		fmt.Fprintf(os.Stderr, "error loading payloads: %v\n", err)
 		os.Exit(1)
 	}
-	defer stefSrv.Stop()
+	sig = payloads[0].signal
+
+	totalItems := 0
+	for _, p := range payloads {
+		totalItems += p.itemCount()
+	}
 
-	formats := []benchFormat{
-		newGRPCFormat("OTLP gRPC", grpcSrv, ""),
-		newGRPCFormat("OTLP gRPC + zstd", grpcSrv, configcompression.TypeZstd),
-		newHTTPFormat("OTLP HTTP proto", httpSrv, otlphttpexporter.EncodingProto, ""),
-		newHTTPFormat("OTLP HTTP proto+zstd", httpSrv, otlphttpexporter.EncodingProto, configcompression.TypeZstd),
-		newHTTPFormat("OTLP HTTP JSON", httpSrv, otlphttpexporter.EncodingJSON, ""),
-		newHTTPFormat("OTLP HTTP JSON+zstd", httpSrv, otlphttpexporter.EncodingJSON, configcompression.TypeZstd),
-		newSTEFExporterFormat("STEF (none)", stefSrv, ""),
-		newSTEFExporterFormat("STEF (zstd)", stefSrv, configcompression.TypeZstd),
+	dataset := datasetSummary{
+		Source:   *inputDir,
+		Signal:   sig,
+		Files:    len(payloads),
+		RawBytes: totalRawBytes,
+		Items:    totalItems,
+	}
+	if *synthetic {
+		dataset.Source = fmt.Sprintf("synthetic (seed %d)", synthCfg.seed)
+	}
+
+	var replayEvents []replayEvent
+	if replay.enabled() {
+		replayEvents, err = replay.schedule(payloads)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: --replay: %v\n", err)
+			os.Exit(1)
+		}
+		load := newReplayLoad(replay, replayEvents, dataset)
+		fmt.Fprintf(os.Stderr, "replaying %d requests over %s per format\n",
+			load.Requests, time.Duration(load.DurationNs).Round(time.Millisecond))
+	}
+
+	// With --isolate the children run the benchmark, so the parent only
+	// needs the format names: it starts no servers and builds no exporters.
+	var formats []benchFormat
+	var isolated []isolatedResult
+	if *isolate {
+		var names []string
+		if *scenarioFile != "" {
+			names, err = scenarioFormatNames(sc, sig)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: --scenario: %v\n", err)
+				os.Exit(1)
+			}
+		} else {
+			names = formatNames(sig, codecs)
+		}
+		if *formatName != "" {
+			name, err := selectFormatName(names, *formatName)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: --format: %v\n", err)
+				os.Exit(1)
+			}
+			names = []string{name}
+		}
+		isolated, err = runIsolated(names, os.Args[1:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: --isolate: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		// Start nop servers for exporters to send to.
+		srvOpts := serverOptions{decode: *decode, faults: faults}
+		if *useTLS {
+			srvOpts.tls, err = newLocalTLS()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error generating TLS certificate: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		srvs, err := startNopServers(srvOpts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		defer srvs.stop()
+
+		if *scenarioFile != "" {
+			formats, err = scenarioFormats(sc, sig, srvs)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: --scenario: %v\n", err)
+				os.Exit(1)
+			}
+		} else {
+			formats = buildFormats(sig, codecs, srvs, queue)
+		}
+		if *formatName != "" {
+			formats, err = selectFormat(formats, *formatName)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: --format: %v\n", err)
+				os.Exit(1)
+			}
+		}
 	}
 
+	shards := shardPayloads(payloads, *concurrency)
+	if len(shards) < *concurrency {
+		fmt.Fprintf(os.Stderr, "note: --concurrency %d capped at %d, one goroutine per payload\n", *concurrency, len(shards))
+	}
+
+	names := make([]string, len(formats))
+	for i, f := range formats {
+		names[i] = f.name
+	}
+	profileFiles := profileFileNames(names)
+
 	results := make([]formatResult, 0, len(formats))
-	for _, f := range formats {
+	for i, f := range formats {
 		fmt.Fprintf(os.Stderr, "benchmarking: %s ...\n", f.name)
 
+		export := f.export
+		if *concurrency > 1 {
+			export = func([]payload) error { return exportShards(f.export, shards) }
+		}
+
+		var base processBaseline
+		if *soakDuration > 0 {
+			base = takeBaseline(f)
+		}
 		if err := f.setup(); err != nil {
 			fmt.Fprintf(os.Stderr, "error setting up %s: %v\n", f.name, err)
 			os.Exit(1)
 		}
 
 		// Warmup.
-		if err := f.export(payloads); err != nil {
+		if err := export(payloads); err != nil {
 			fmt.Fprintf(os.Stderr, "error in %s warmup: %v\n", f.name, err)
 			os.Exit(1)
 		}
 		f.size() // discard warmup bytes
+		f.socket()
 
 		// Measure size from one iteration.
-		if err := f.export(payloads); err != nil {
+		if err := export(payloads); err != nil {
 			fmt.Fprintf(os.Stderr, "error in %s: %v\n", f.name, err)
 			os.Exit(1)
 		}
 		size := f.size()
+		socket := f.socket()
 
-		// Timed iterations with memory tracking.
-		runtime.GC()
-		var memBefore runtime.MemStats
-		runtime.ReadMemStats(&memBefore)
-
-		start := time.Now()
+		var verified *verification
+		if *verify {
+			v, err := verifyFormat(f, export, payloads)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error verifying %s: %v\n", f.name, err)
+				os.Exit(1)
+			}
+			verified = &v
+			f.size() // discard verify bytes
+			f.socket()
+		}
+		f.decoded()  // discard untimed decode work
+		f.delivery() // and untimed retries and drops
+
+		// Timed iterations with per-iteration memory tracking. ReadMemStats
+		// runs between iterations, outside the timed region; the heap
+		// sampler reads runtime/metrics alongside, without stopping the
+		// world.
+		heap := startHeapSampler()
+		var prof *formatProfiler
+		if profiles.enabled() {
+			prof, err = startFormatProfiler(profiles, profileFiles[i])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error profiling %s: %v\n", f.name, err)
+				os.Exit(1)
+			}
+		}
+		samples := make([]iterationSample, 0, *iterations)
+		var elapsed time.Duration
+		var totalAllocs, totalAllocBytes int64
+		var memBefore, memAfter runtime.MemStats
 		for i := 0; i < *iterations; i++ {
-			if err := f.export(payloads); err != nil {
+			runtime.ReadMemStats(&memBefore)
+			cpuStart := processCPUTime()
+			start := time.Now()
+			err := export(payloads)
+			d := time.Since(start)
+			cpu := processCPUTime() - cpuStart
+			runtime.ReadMemStats(&memAfter)
+			if err != nil {
 				fmt.Fprintf(os.Stderr, "error in %s iteration %d: %v\n", f.name, i, err)
 				os.Exit(1)
 			}
+
+			sample := iterationSample{
+				elapsed:    d,
+				cpu:        cpu,
+				allocs:     int64(memAfter.Mallocs - memBefore.Mallocs),
+				allocBytes: int64(memAfter.TotalAlloc - memBefore.TotalAlloc),
+				decode:     f.decoded(),
+				delivery:   f.delivery(),
+			}
+			samples = append(samples, sample)
+			elapsed += sample.elapsed
+			totalAllocs += sample.allocs
+			totalAllocBytes += sample.allocBytes
 		}
-		elapsed := time.Since(start)
 
-		var memAfter runtime.MemStats
-		runtime.ReadMemStats(&memAfter)
+		growth := heap.stop()
+		var allocs *allocProfile
+		if prof != nil {
+			allocs, err = prof.stop()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error writing %s profile: %v\n", f.name, err)
+				os.Exit(1)
+			}
+		}
 
 		f.size() // discard timed bytes
-		f.cleanup()
+		f.socket()
+
+		var replayed *replayResult
+		if replay.enabled() {
+			r, err := runReplay(f, replayEvents)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error in %s replay: %v\n", f.name, err)
+				os.Exit(1)
+			}
+			replayed = &r
+			f.size() // discard replay bytes
+			f.socket()
+			f.decoded()
+			f.delivery()
+		}
 
-		allocBytes := int64(memAfter.TotalAlloc-memBefore.TotalAlloc) / int64(*iterations)
-		numAllocs := int64(memAfter.Mallocs-memBefore.Mallocs) / int64(*iterations)
+		var soaked *soakResult
+		if *soakDuration > 0 {
+			fmt.Fprintf(os.Stderr, "soaking %s for %s ...\n", f.name, *soakDuration)
+			r, err := runSoak(export, payloads, *soakDuration, soakInterval(*soakDuration))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error in %s soak: %v\n", f.name, err)
+				os.Exit(1)
+			}
+			soaked = &r
+			f.size() // discard soak bytes
+			f.socket()
+			f.decoded()
+			f.delivery()
+		}
+
+		f.cleanup()
+		if soaked != nil {
+			soaked.leaked = checkLeaks(f, base, leakGrace)
+		}
+		var fileBytes []int64
+		if *perFile {
+			fileBytes, err = perFileSizes(f, payloads)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error in %s per-file export: %v\n", f.name, err)
+				os.Exit(1)
+			}
+		}
 
-		results = append(results, formatResult{
+		res := formatResult{
 			name:          f.name,
+			codec:         f.codec,
 			totalBytes:    size,
+			socket:        socket,
 			serializeTime: elapsed / time.Duration(*iterations),
-			allocBytes:    allocBytes,
-			numAllocs:     numAllocs,
-		})
+			allocBytes:    totalAllocBytes / int64(*iterations),
+			numAllocs:     totalAllocs / int64(*iterations),
+			samples:       samples,
+		}
+		if *decode {
+			res.decode = meanDecodeStats(samples)
+		}
+		res.verify = verified
+		if faults.active() {
+			res.delivery = meanDelivery(samples, growth)
+		}
+		res.allocs = allocs
+		res.fileBytes = fileBytes
+		res.replay = replayed
+		res.soak = soaked
+		res.memory = heap.memory()
+		results = append(results, res)
 	}
 
-	fmt.Printf("## Results (avg over %d iterations)\n\n", *iterations)
-	fmt.Println("| Format | Total Size | Ratio vs Raw | Serialize Time | Allocs/op | Bytes/op |")
-	fmt.Println("|--------|-----------|--------------|----------------|-----------|----------|")
-	for _, r := range results {
-		ratio := float64(totalRawBytes) / float64(r.totalBytes)
-		fmt.Printf("| %-22s | %8.1f MB | %10.2fx | %12s | %9d | %8.1f MB |\n",
-			r.name,
-			float64(r.totalBytes)/1024/1024,
-			ratio,
-			r.serializeTime.Round(time.Microsecond),
-			r.numAllocs,
-			float64(r.allocBytes)/1024/1024,
-		)
+	out := os.Stdout
+	if *outputFile != "" {
+		out, err = os.Create(*outputFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error creating output file: %v\n", err)
+			os.Exit(1)
+		}
+		defer out.Close()
+	}
+	rep := newReport(dataset, *iterations, *cvWarn, results)
+	// Fewer payloads than --concurrency leave goroutines without a shard.
+	rep.Concurrency = len(shards)
+	if *scenarioFile == "" {
+		rep.Queue = queue.String()
+		if queue.retry.Enabled {
+			rep.Retry = queue.retry.InitialInterval.String()
+		}
+	}
+	rep.Faults = faults.String()
+	rep.TLS = *useTLS
+	if *perFile && !*isolate {
+		rep.Files = newFileRecords(payloads, results)
+	}
+	if replay.enabled() {
+		rep.Replay = newReplayLoad(replay, replayEvents, dataset)
+	}
+	if *soakDuration > 0 {
+		rep.Soak = soakDuration.String()
+	}
+	if *isolate {
+		mergeIsolated(&rep, isolated)
+	}
+	// Isolated children already warned about their own results.
+	if !*isolate {
+		warnResults(rep)
+	}
+	if err := writeReport(out, rep, *outputFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "error writing results: %v\n", err)
+		os.Exit(1)
 	}
 }
 
-func newGRPCFormat(name string, srv *grpcServer, compression configcompression.Type) benchFormat {
-	var exp exporter.Metrics
+// warnResults points out noisy timings, failed verifications, soak growth
+// and leaks on stderr.
+func warnResults(rep report) {
+	for _, res := range rep.Results {
+		if res.Noisy {
+			fmt.Fprintf(os.Stderr, "warning: %s serialize time varies by %.0f%% (CV) across iterations; consider more iterations or a quieter host\n",
+				res.Format, res.SerializeTime.CV*100)
+		}
+	}
+	for _, res := range rep.Results {
+		if v := res.Verify; v != nil && !v.ok() {
+			lost := v.lost()
+			fmt.Fprintf(os.Stderr, "warning: %s failed verification: lost %d %s, %d attributes and %d exemplars\n",
+				res.Format, lost.Items, rep.Dataset.Signal.itemName(), lost.Attributes, lost.Exemplars)
+			if v.FirstDiff != "" {
+				fmt.Fprintf(os.Stderr, "  %d mismatched %s, first difference: %s\n", v.Mismatched, v.unit(rep.Dataset.Signal), v.FirstDiff)
+			}
+		}
+	}
+	for _, res := range rep.Results {
+		sk := res.Soak
+		if sk == nil {
+			continue
+		}
+		if g := sk.growth(); len(g) > 0 {
+			fmt.Fprintf(os.Stderr, "warning: %s kept growing over the soak: %s\n", res.Format, strings.Join(g, ", "))
+		}
+		if l := sk.leaked(); l.any() {
+			fmt.Fprintf(os.Stderr, "warning: %s left %s after Shutdown\n", res.Format, l)
+		}
+	}
+}
 
-	return benchFormat{
-		name: name,
-		setup: func() error {
-			factory := otlpexporter.NewFactory()
-			cfg := factory.CreateDefaultConfig().(*otlpexporter.Config)
-			cfg.ClientConfig.Endpoint = srv.Endpoint()
-			cfg.ClientConfig.TLS = configtls.ClientConfig{Insecure: true}
-			cfg.ClientConfig.Compression = compression
-			cfg.RetryConfig = configretry.BackOffConfig{Enabled: false}
-			cfg.QueueConfig = configoptional.None[exporterhelper.QueueBatchConfig]()
+// selectFormat narrows formats to the one named name, either in full or by
+// its key.
+func selectFormat(formats []benchFormat, name string) ([]benchFormat, error) {
+	names := make([]string, len(formats))
+	for i, f := range formats {
+		names[i] = f.name
+	}
+	full, err := selectFormatName(names, name)
+	if err != nil {
+		return nil, err
+	}
+	i := slices.Index(names, full)
+	return formats[i : i+1], nil
+}
 
-			ctx := context.Background()
-			var err error
-			exp, err = factory.CreateMetrics(ctx, exportertest.NewNopSettings(factory.Type()), cfg)
-			if err != nil {
-				return fmt.Errorf("create exporter: %w", err)
-			}
-			return exp.Start(ctx, componenttest.NewNopHost())
-		},
-		export: func(ps []payload) error {
-			ctx := context.Background()
-			for _, p := range ps {
-				if err := exp.ConsumeMetrics(ctx, p.req.Metrics()); err != nil {
-					return err
-				}
-			}
-			return nil
-		},
-		size:    func() int64 { return srv.Counter.ReadAndReset() },
-		cleanup: func() { exp.Shutdown(context.Background()) },
+// selectFormatName returns the full name of the format named name, either
+// in full or by its key.
+func selectFormatName(names []string, name string) (string, error) {
+	for _, n := range names {
+		if n == name || formatKey(n) == name {
+			return n, nil
+		}
 	}
+	return "", fmt.Errorf("no format %q (have %s)", name, strings.Join(names, ", "))
 }
 
-func newHTTPFormat(name string, srv *httpServer, encoding otlphttpexporter.EncodingType, compression configcompression.Type) benchFormat {
-	var exp exporter.Metrics
+// newExporterFormat benchmarks an exporter created by factory. configure
+// adjusts the factory's default config, e.g. to point it at a nop server,
+// before the exporter is created. When the config enables an asynchronous
+// sending_queue, each export waits for the queue to drain. When the server
+// injects faults, failed exports count as dropped items rather than errors.
+func newExporterFormat(name string, sig signal, factory exporter.Factory, configure func(component.Config) error, stats serverStats) benchFormat {
+	var exp *payloadExporter
+	var host *exporterHost
+	var drain *queueDrain
+	var retries retryCounter
+	var dropped atomic.Int64
+	var queueFailed int64
+	lossy := stats.Faults != nil
 
 	return benchFormat{
 		name: name,
 		setup: func() error {
-			factory := otlphttpexporter.NewFactory()
-			cfg := factory.CreateDefaultConfig().(*otlphttpexporter.Config)
-			cfg.ClientConfig.Endpoint = srv.Endpoint()
-			cfg.ClientConfig.Compression = compression
-			cfg.Encoding = encoding
-			cfg.RetryConfig = configretry.BackOffConfig{Enabled: false}
-			cfg.QueueConfig = configoptional.None[exporterhelper.QueueBatchConfig]()
+			cfg := factory.CreateDefaultConfig()
+			if err := configure(cfg); err != nil {
+				return err
+			}
 
 			ctx := context.Background()
+			set := exportertest.NewNopSettings(factory.Type())
+			if lossy {
+				set.TelemetrySettings.Logger = retries.logger()
+			}
+			q, queued := sendingQueueOf(cfg)
+			// Only a persistent queue needs the file_storage extension.
+			var startHost component.Host = componenttest.NewNopHost()
+			host = nil
+			if queued && q.StorageID != nil {
+				var err error
+				if host, err = startExporterHost(ctx); err != nil {
+					return err
+				}
+				startHost = host
+			}
+			drain, queueFailed = nil, 0
+			if queued && !q.WaitForResult {
+				drain = newQueueDrain()
+				drain.lossy = lossy
+				set = drain.instrument(set)
+			}
 			var err error
-			exp, err = factory.CreateMetrics(ctx, exportertest.NewNopSettings(factory.Type()), cfg)
+			exp, err = createPayloadExporter(ctx, factory, set, cfg, sig)
 			if err != nil {
 				return fmt.Errorf("create exporter: %w", err)
 			}
-			return exp.Start(ctx, componenttest.NewNopHost())
+			return exp.Start(ctx, startHost)
 		},
 		export: func(ps []payload) error {
 			ctx := context.Background()
 			for _, p := range ps {
-				if err := exp.ConsumeMetrics(ctx, p.req.Metrics()); err != nil {
-					return err
+				if err := exp.consume(ctx, p); err != nil {
+					if !lossy {
+						return err
+					}
+					dropped.Add(int64(p.itemCount()))
+					continue
 				}
+				if drain != nil {
+					drain.added(p.itemCount())
+				}
+			}
+			if drain != nil {
+				return drain.wait()
 			}
 			return nil
 		},
-		size:    func() int64 { return srv.Counter.ReadAndReset() },
-		cleanup: func() { exp.Shutdown(context.Background()) },
-	}
-}
-
-func newSTEFExporterFormat(name string, srv *stefServer, compression configcompression.Type) benchFormat {
-	var exp exporter.Metrics
-
-	return benchFormat{
-		name: name,
-		setup: func() error {
-			factory := stefexporter.NewFactory()
-			cfg := factory.CreateDefaultConfig().(*stefexporter.Config)
-			cfg.ClientConfig.Endpoint = srv.Endpoint()
-			cfg.ClientConfig.TLS = configtls.ClientConfig{Insecure: true}
-			cfg.ClientConfig.Compression = compression
-			cfg.TimeoutConfig = exporterhelper.TimeoutConfig{Timeout: 2 * time.Minute}
-			cfg.RetryConfig = configretry.BackOffConfig{Enabled: false}
-			qCfg := exporterhelper.NewDefaultQueueConfig()
-			qCfg.QueueSize = 50000
-			cfg.QueueConfig = configoptional.Some(qCfg)
-
-			ctx := context.Background()
-			var err error
-			exp, err = factory.CreateMetrics(ctx, exportertest.NewNopSettings(factory.Type()), cfg)
-			if err != nil {
-				return fmt.Errorf("create exporter: %w", err)
+		size:      stats.Counter.ReadAndReset,
+		socket:    stats.Socket.ReadAndReset,
+		openConns: stats.Socket.Open,
+		decoded:   stats.Decode.ReadAndReset,
+		delivery: func() deliveryStats {
+			d := deliveryStats{retries: retries.retries.Swap(0), dropped: dropped.Swap(0)}
+			if drain != nil {
+				_, failed := drain.counts()
+				d.dropped += failed - queueFailed
+				queueFailed = failed
+			}
+			if stats.Faults != nil {
+				d.faultStats = stats.Faults.ReadAndReset()
 			}
-			return exp.Start(ctx, componenttest.NewNopHost())
+			return d
 		},
-		export: func(ps []payload) error {
+		cleanup: func() {
 			ctx := context.Background()
-			for _, p := range ps {
-				if err := exp.ConsumeMetrics(ctx, p.req.Metrics()); err != nil {
-					return err
-				}
+			exp.Shutdown(ctx)
+			if host != nil {
+				host.shutdown(ctx)
 			}
-			return nil
 		},
-		size:    func() int64 { return srv.Counter.ReadAndReset() },
-		cleanup: func() { exp.Shutdown(context.Background()) },
+		capture: stats.Capture,
 	}
 }
 
-func loadPayloads(dir string) ([]payload, int64, error) {
-	matches, err := filepath.Glob(filepath.Join(dir, "*.pb"))
-	if err != nil {
-		return nil, 0, fmt.Errorf("globbing %s: %w", dir, err)
-	}
-	if len(matches) == 0 {
-		return nil, 0, fmt.Errorf("no .pb files found in %s", dir)
-	}
-	sort.Strings(matches)
-
-	var payloads []payload
-	var totalRawBytes int64
+func newGRPCFormat(name string, sig signal, srv *grpcServer, c codec, q queueMode) benchFormat {
+	f := newExporterFormat(name, sig, otlpexporter.NewFactory(), func(cfg component.Config) error {
+		oCfg := cfg.(*otlpexporter.Config)
+		oCfg.ClientConfig.Endpoint = srv.Endpoint()
+		oCfg.ClientConfig.TLS = clientTLS(srv.tls)
+		oCfg.ClientConfig.Compression = c.typ
+		oCfg.RetryConfig = q.retry
+		oCfg.QueueConfig = q.sendingQueue()
+		return nil
+	}, srv.serverStats)
+	f.codec = c
+	return f
+}
 
-	for _, path := range matches {
-		data, err := os.ReadFile(path)
-		if err != nil {
-			return nil, 0, fmt.Errorf("reading %s: %w", path, err)
-		}
+func newHTTPFormat(name string, sig signal, srv *httpServer, encoding otlphttpexporter.EncodingType, c codec, q queueMode) benchFormat {
+	f := newExporterFormat(name, sig, otlphttpexporter.NewFactory(), func(cfg component.Config) error {
+		hCfg := cfg.(*otlphttpexporter.Config)
+		hCfg.ClientConfig.Endpoint = srv.Endpoint()
+		hCfg.ClientConfig.TLS = clientTLS(srv.tls)
+		hCfg.ClientConfig.Compression = c.typ
+		hCfg.ClientConfig.CompressionParams = c.params()
+		hCfg.Encoding = encoding
+		hCfg.RetryConfig = q.retry
+		hCfg.QueueConfig = q.sendingQueue()
+		return nil
+	}, srv.serverStats)
+	f.codec = c
+	return f
+}
 
-		req := pmetricotlp.NewExportRequest()
-		if err := req.UnmarshalProto(data); err != nil {
-			return nil, 0, fmt.Errorf("unmarshaling %s: %w", path, err)
+func newSTEFExporterFormat(name string, srv *stefServer, c codec, q queueMode) benchFormat {
+	f := newExporterFormat(name, signalMetrics, stefexporter.NewFactory(), func(cfg component.Config) error {
+		sCfg := cfg.(*stefexporter.Config)
+		sCfg.ClientConfig.Endpoint = srv.Endpoint()
+		sCfg.ClientConfig.TLS = clientTLS(srv.tls)
+		sCfg.ClientConfig.Compression = c.typ
+		sCfg.TimeoutConfig = exporterhelper.TimeoutConfig{Timeout: 2 * time.Minute}
+		sCfg.RetryConfig = q.retry
+		if q.enabled() {
+			sCfg.QueueConfig = q.sendingQueue()
+		} else {
+			qCfg := exporterhelper.NewDefaultQueueConfig()
+			qCfg.QueueSize = 50000
+			sCfg.QueueConfig = configoptional.Some(qCfg)
 		}
+		return nil
+	}, srv.serverStats)
+	f.codec = c
+	f.regroups = true
+	return f
+}
 
-		payloads = append(payloads, payload{
-			filename: filepath.Base(path),
-			raw:      data,
-			req:      req,
-		})
-		totalRawBytes += int64(len(data))
-	}
-
-	return payloads, totalRawBytes, nil
+func newArrowFormat(name string, sig signal, srv *arrowServer, c codec, q queueMode) benchFormat {
+	f := newExporterFormat(name, sig, otelarrowexporter.NewFactory(), func(cfg component.Config) error {
+		aCfg := cfg.(*otelarrowexporter.Config)
+		aCfg.ClientConfig.Endpoint = srv.Endpoint()
+		aCfg.ClientConfig.TLS = clientTLS(srv.tls)
+		aCfg.ClientConfig.Compression = c.typ
+		aCfg.RetryConfig = q.retry
+		aCfg.QueueSettings = q.sendingQueue()
+		return nil
+	}, srv.serverStats)
+	f.codec = c
+	// Arrow sorts and regroups attributes and resources, so the decoded
+	// requests never match the input byte for byte.
+	f.regroups = true
+	return f
 }
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// droppedFile is the per-file size of a file whose items were dropped under
+// --faults, which says nothing about the format's encoding.
+const droppedFile = -1
+
+// perFileSizes exports the payloads one at a time and returns the wire bytes
+// of each. Every file gets an exporter of its own, so stateful formats (OTel
+// Arrow, STEF) start a fresh stream for it: its size includes the schemas and
+// dictionaries it needs, as if it were the only file sent, rather than
+// reusing those of the warmup and earlier files. f must not be set up.
+func perFileSizes(f benchFormat, payloads []payload) ([]int64, error) {
+	sizes := make([]int64, len(payloads))
+	f.size()
+	for i, p := range payloads {
+		if err := f.setup(); err != nil {
+			return nil, fmt.Errorf("%s: %w", p.filename, err)
+		}
+		err := f.export([]payload{p})
+		// Shutting down flushes what queued exporters still hold.
+		f.cleanup()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p.filename, err)
+		}
+		sizes[i] = f.size()
+		if f.delivery != nil && f.delivery().dropped > 0 {
+			sizes[i] = droppedFile
+		}
+	}
+	return sizes, nil
+}
+
+// fileRecord is one input file in the --per-file report.
+type fileRecord struct {
+	File      string           `json:"file"`
+	RawBytes  int64            `json:"raw_bytes"`
+	Items     int              `json:"items"`
+	WireBytes map[string]int64 `json:"wire_bytes"`
+	// Dropped lists the formats that dropped some of the file's items
+	// under --faults; they have no wire size for it.
+	Dropped    []string `json:"dropped,omitempty"`
+	BestFormat string   `json:"best_format,omitempty"`
+	BestRatio  float64  `json:"best_ratio,omitempty"`
+}
+
+// newFileRecords lines up the per-file sizes of every format. The best
+// format is the smallest on the wire; formats whose server saw nothing, or
+// that dropped items of the file, are skipped rather than winning.
+func newFileRecords(payloads []payload, results []formatResult) []fileRecord {
+	names := make([]string, len(results))
+	for i, res := range results {
+		names[i] = res.name
+	}
+	records := make([]fileRecord, len(payloads))
+	for i, p := range payloads {
+		rec := fileRecord{
+			File:      filepath.Base(p.filename),
+			RawBytes:  int64(len(p.raw)),
+			Items:     p.itemCount(),
+			WireBytes: map[string]int64{},
+		}
+		for _, res := range results {
+			switch {
+			case i >= len(res.fileBytes):
+			case res.fileBytes[i] == droppedFile:
+				rec.Dropped = append(rec.Dropped, res.name)
+			default:
+				rec.WireBytes[res.name] = res.fileBytes[i]
+			}
+		}
+		rec.pickBest(names)
+		records[i] = rec
+	}
+	return records
+}
+
+// pickBest sets the smallest nonzero wire size among formats as the best,
+// the first of them on a tie.
+func (rec *fileRecord) pickBest(formats []string) {
+	rec.BestFormat, rec.BestRatio = "", 0
+	var best int64
+	for _, name := range formats {
+		size := rec.WireBytes[name]
+		if size > 0 && (best == 0 || size < best) {
+			best = size
+			rec.BestFormat = name
+		}
+	}
+	if best > 0 {
+		rec.BestRatio = float64(rec.RawBytes) / float64(best)
+	}
+}
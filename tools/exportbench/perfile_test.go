@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"go.opentelemetry.io/collector/exporter/otlphttpexporter"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+)
+
+func TestPerFileSizes(t *testing.T) {
+	// perFileSizes sets up an exporter per file itself.
+	f := newHTTPFormat("per-file", testSignal, testHTTPServer, otlphttpexporter.EncodingProto, codec{}, queueMode{})
+	sizes, err := perFileSizes(f, testPayloads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Uncompressed OTLP/HTTP proto sends each file as is.
+	for i, p := range testPayloads {
+		if sizes[i] != int64(len(p.raw)) {
+			t.Errorf("%s: %d wire bytes, want %d", p.filename, sizes[i], len(p.raw))
+		}
+	}
+}
+
+func TestNewFileRecords(t *testing.T) {
+	payloads := []payload{
+		{filename: "dir/a.pb", raw: make([]byte, 1000), signal: signalMetrics, metrics: pmetricotlp.NewExportRequest()},
+		{filename: "dir/b.pb", raw: make([]byte, 2000), signal: signalMetrics, metrics: pmetricotlp.NewExportRequest()},
+	}
+	results := []formatResult{
+		{name: "X", fileBytes: []int64{500, 400}},
+		{name: "Y", fileBytes: []int64{250, 800}},
+		// A server that saw nothing never wins.
+		{name: "Z", fileBytes: []int64{0, 0}},
+		// Nor does a format that dropped the file's items.
+		{name: "W", fileBytes: []int64{droppedFile, 100}},
+	}
+	records := newFileRecords(payloads, results)
+	if records[0].File != "a.pb" || records[0].BestFormat != "Y" || records[0].BestRatio != 4 {
+		t.Errorf("a.pb = %+v, want Y at 4x", records[0])
+	}
+	if _, ok := records[0].WireBytes["W"]; ok || len(records[0].Dropped) != 1 {
+		t.Errorf("a.pb = %+v, want W dropped", records[0])
+	}
+	if records[1].BestFormat != "W" || records[1].BestRatio != 20 || records[1].WireBytes["Y"] != 800 {
+		t.Errorf("b.pb = %+v, want W at 20x", records[1])
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// topAllocSites is how many allocation sites the report lists per format.
+const topAllocSites = 5
+
+// profileDirs are the --cpuprofile-dir and --memprofile-dir directories.
+// Either may be empty.
+type profileDirs struct {
+	cpu string
+	mem string
+}
+
+func (d profileDirs) enabled() bool {
+	return d.cpu != "" || d.mem != ""
+}
+
+// profileFileNames turns format names into unique file names, e.g.
+// "OTLP gRPC + zstd" into "otlp-grpc-zstd.pprof".
+func profileFileNames(names []string) []string {
+	files := make([]string, len(names))
+	seen := map[string]int{}
+	for i, name := range names {
+		var b strings.Builder
+		dash := false
+		for _, r := range strings.ToLower(name) {
+			if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+				if dash && b.Len() > 0 {
+					b.WriteByte('-')
+				}
+				b.WriteRune(r)
+				dash = false
+			} else {
+				dash = true
+			}
+		}
+		base := b.String()
+		if base == "" {
+			base = "format"
+		}
+		seen[base]++
+		if n := seen[base]; n > 1 {
+			base += "-" + strconv.Itoa(n)
+		}
+		files[i] = base + ".pprof"
+	}
+	return files
+}
+
+// allocSite is the innermost non-runtime frame of sampled allocations, with
+// the allocations attributed to it.
+type allocSite struct {
+	function string
+	file     string
+	line     int
+	objects  int64
+	bytes    int64
+}
+
+// allocProfile summarizes the allocations sampled during a format's timed
+// iterations. The totals are estimates scaled up from the samples, as in
+// pprof, and cover the whole process, so they include the nop servers.
+type allocProfile struct {
+	objects int64
+	bytes   int64
+	sites   []allocSite // the largest by bytes
+}
+
+// formatProfiler profiles one format's timed iterations. The CPU profile is
+// written as it runs. The heap profile is the difference between two
+// snapshots of the runtime's allocation records, so that it excludes the
+// warmup and every other format.
+type formatProfiler struct {
+	cpuFile *os.File
+	memPath string
+	start   time.Time
+	base    map[memProfileKey]runtime.MemProfileRecord
+}
+
+// memProfileKey identifies a runtime allocation record, which is kept per
+// stack and object size.
+type memProfileKey struct {
+	stack [32]uintptr
+	size  int64
+}
+
+func keyOf(r runtime.MemProfileRecord) memProfileKey {
+	k := memProfileKey{stack: r.Stack0}
+	if r.AllocObjects > 0 {
+		k.size = r.AllocBytes / r.AllocObjects
+	}
+	return k
+}
+
+// startFormatProfiler starts profiling into file in each enabled directory.
+func startFormatProfiler(dirs profileDirs, file string) (*formatProfiler, error) {
+	p := &formatProfiler{}
+	if dirs.cpu != "" {
+		f, err := os.Create(filepath.Join(dirs.cpu, file))
+		if err != nil {
+			return nil, err
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+		p.cpuFile = f
+	}
+	if dirs.mem != "" {
+		// The runtime publishes allocation records at the end of a cycle,
+		// so collect to take in everything allocated until now, including
+		// the CPU profiler's buffers.
+		runtime.GC()
+		p.memPath = filepath.Join(dirs.mem, file)
+		p.base = map[memProfileKey]runtime.MemProfileRecord{}
+		for _, r := range readMemProfile() {
+			p.base[keyOf(r)] = r
+		}
+	}
+	p.start = time.Now()
+	return p, nil
+}
+
+// stop ends the profiles and writes the heap profile. It returns the
+// allocation summary, or nil when heap profiling is off.
+func (p *formatProfiler) stop() (*allocProfile, error) {
+	if p.cpuFile != nil {
+		pprof.StopCPUProfile()
+		if err := p.cpuFile.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if p.memPath == "" {
+		return nil, nil
+	}
+
+	// Publish the allocations of the last iterations.
+	runtime.GC()
+	duration := time.Since(p.start)
+	var delta []runtime.MemProfileRecord
+	for _, r := range readMemProfile() {
+		b := p.base[keyOf(r)]
+		r.AllocObjects -= b.AllocObjects
+		r.AllocBytes -= b.AllocBytes
+		if r.AllocObjects > 0 {
+			delta = append(delta, r)
+		}
+	}
+
+	f, err := os.Create(p.memPath)
+	if err != nil {
+		return nil, err
+	}
+	err = buildAllocProfile(delta, p.start, duration).Write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return summarizeAllocs(delta), nil
+}
+
+func readMemProfile() []runtime.MemProfileRecord {
+	n, _ := runtime.MemProfile(nil, true)
+	for {
+		// Leave room for records added in between.
+		records := make([]runtime.MemProfileRecord, n+64)
+		var ok bool
+		n, ok = runtime.MemProfile(records, true)
+		if ok {
+			return records[:n]
+		}
+	}
+}
+
+// trimRuntimeFrames drops the allocator's own frames from the top of an
+// allocation stack, as runtime/pprof does, unless nothing else is left.
+func trimRuntimeFrames(stk []uintptr) []uintptr {
+	for i, pc := range stk {
+		f := runtime.FuncForPC(pc)
+		if f == nil || !strings.HasPrefix(f.Name(), "runtime.") && !strings.HasPrefix(f.Name(), "internal/runtime/") {
+			return stk[i:]
+		}
+	}
+	return stk
+}
+
+// scaleAllocs estimates the allocations that a record's samples stand for,
+// as runtime/pprof does.
+func scaleAllocs(objects, bytes int64) (int64, int64) {
+	rate := int64(runtime.MemProfileRate)
+	if objects == 0 || bytes == 0 {
+		return 0, 0
+	}
+	if rate <= 1 {
+		return objects, bytes
+	}
+	avg := float64(bytes) / float64(objects)
+	scale := 1 / (1 - math.Exp(-avg/float64(rate)))
+	return int64(float64(objects) * scale), int64(float64(bytes) * scale)
+}
+
+func summarizeAllocs(records []runtime.MemProfileRecord) *allocProfile {
+	prof := &allocProfile{}
+	sites := map[string]*allocSite{}
+	for _, r := range records {
+		objects, bytes := scaleAllocs(r.AllocObjects, r.AllocBytes)
+		prof.objects += objects
+		prof.bytes += bytes
+
+		site, _ := runtime.CallersFrames(trimRuntimeFrames(r.Stack())).Next()
+		key := site.Function + "\x00" + site.File + "\x00" + strconv.Itoa(site.Line)
+		s, ok := sites[key]
+		if !ok {
+			s = &allocSite{function: site.Function, file: site.File, line: site.Line}
+			sites[key] = s
+		}
+		s.objects += objects
+		s.bytes += bytes
+	}
+	for _, s := range sites {
+		prof.sites = append(prof.sites, *s)
+	}
+	slices.SortFunc(prof.sites, func(a, b allocSite) int {
+		if c := cmp.Compare(b.bytes, a.bytes); c != 0 {
+			return c
+		}
+		return strings.Compare(a.function, b.function)
+	})
+	if len(prof.sites) > topAllocSites {
+		prof.sites = prof.sites[:topAllocSites]
+	}
+	return prof
+}
+
+// buildAllocProfile turns records into a profile with the alloc_objects
+// and alloc_space sample types of a Go allocs profile, with functions and
+// lines resolved, so that go tool pprof reads it without the binary.
+func buildAllocProfile(records []runtime.MemProfileRecord, start time.Time, duration time.Duration) *profile.Profile {
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "alloc_objects", Unit: "count"},
+			{Type: "alloc_space", Unit: "bytes"},
+		},
+		DefaultSampleType: "alloc_space",
+		PeriodType:        &profile.ValueType{Type: "space", Unit: "bytes"},
+		Period:            int64(runtime.MemProfileRate),
+		TimeNanos:         start.UnixNano(),
+		DurationNanos:     duration.Nanoseconds(),
+	}
+	locations := map[uintptr]*profile.Location{}
+	functions := map[string]*profile.Function{}
+	location := func(pc uintptr) *profile.Location {
+		if loc, ok := locations[pc]; ok {
+			return loc
+		}
+		loc := &profile.Location{ID: uint64(len(prof.Location) + 1), Address: uint64(pc)}
+		// One PC expands to its inlined calls, innermost first.
+		frames := runtime.CallersFrames([]uintptr{pc})
+		for {
+			frame, more := frames.Next()
+			fn, ok := functions[frame.Function]
+			if !ok {
+				fn = &profile.Function{
+					ID:         uint64(len(prof.Function) + 1),
+					Name:       frame.Function,
+					SystemName: frame.Function,
+					Filename:   frame.File,
+				}
+				functions[frame.Function] = fn
+				prof.Function = append(prof.Function, fn)
+			}
+			loc.Line = append(loc.Line, profile.Line{Function: fn, Line: int64(frame.Line)})
+			if !more {
+				break
+			}
+		}
+		locations[pc] = loc
+		prof.Location = append(prof.Location, loc)
+		return loc
+	}
+
+	for _, r := range records {
+		objects, bytes := scaleAllocs(r.AllocObjects, r.AllocBytes)
+		sample := &profile.Sample{Value: []int64{objects, bytes}}
+		for _, pc := range trimRuntimeFrames(r.Stack()) {
+			sample.Location = append(sample.Location, location(pc))
+		}
+		prof.Sample = append(prof.Sample, sample)
+	}
+	return prof
+}
+
+// shortLocation is a site's file base name and line, e.g. "proto.go:123".
+func (s allocSite) shortLocation() string {
+	return fmt.Sprintf("%s:%d", filepath.Base(s.file), s.line)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+func TestProfileFileNames(t *testing.T) {
+	got := profileFileNames([]string{"OTLP gRPC + zstd", "STEF (none)", "otlp grpc zstd", "+"})
+	want := []string{"otlp-grpc-zstd.pprof", "stef-none.pprof", "otlp-grpc-zstd-2.pprof", "format.pprof"}
+	if !slices.Equal(got, want) {
+		t.Errorf("profileFileNames = %q, want %q", got, want)
+	}
+}
+
+var profileSink [][]byte
+
+//go:noinline
+func allocateForProfile() {
+	for range 1000 {
+		profileSink = append(profileSink, make([]byte, 4096))
+	}
+}
+
+func TestFormatProfiler(t *testing.T) {
+	old := runtime.MemProfileRate
+	runtime.MemProfileRate = 1
+	defer func() { runtime.MemProfileRate = old }()
+
+	dirs := profileDirs{cpu: t.TempDir(), mem: t.TempDir()}
+	p, err := startFormatProfiler(dirs, "test.pprof")
+	if err != nil {
+		t.Fatal(err)
+	}
+	allocateForProfile()
+	allocs, err := p.stop()
+	profileSink = nil
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dir := range []string{dirs.cpu, dirs.mem} {
+		if fi, err := os.Stat(filepath.Join(dir, "test.pprof")); err != nil || fi.Size() == 0 {
+			t.Errorf("profile in %s: %v", dir, err)
+		}
+	}
+	// The heap profile parses, with a Go allocs profile's sample types.
+	f, err := os.Open(filepath.Join(dirs.mem, "test.pprof"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	prof, err := profile.Parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := prof.CheckValid(); err != nil {
+		t.Fatal(err)
+	}
+	if len(prof.SampleType) != 2 || prof.SampleType[1].Type != "alloc_space" || len(prof.Sample) == 0 {
+		t.Errorf("heap profile has sample types %v and %d samples", prof.SampleType, len(prof.Sample))
+	}
+
+	// The test's own allocations lead the summary.
+	if len(allocs.sites) == 0 || !strings.HasSuffix(allocs.sites[0].function, ".allocateForProfile") {
+		t.Fatalf("top sites = %+v, want allocateForProfile first", allocs.sites)
+	}
+	if s := allocs.sites[0]; s.objects < 1000 || s.bytes < 1000*4096 {
+		t.Errorf("allocateForProfile = %d objects, %d bytes, want at least 1000 and %d", s.objects, s.bytes, 1000*4096)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/config/configoptional"
+	"go.opentelemetry.io/collector/config/configretry"
+	"go.opentelemetry.io/collector/confmap"
+	"go.opentelemetry.io/collector/confmap/xconfmap"
+	"go.opentelemetry.io/collector/exporter"
+	"go.opentelemetry.io/collector/exporter/exporterhelper"
+	"go.opentelemetry.io/collector/extension"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+
+	"github.com/open-telemetry/opentelemetry-collector-contrib/extension/storage/filestorage"
+)
+
+// queueMode is the exporterhelper sending_queue selected by --queue and
+// --batch, and the retry_on_failure selected by --retry. The zero value
+// disables both, as the built-in formats historically did.
+type queueMode struct {
+	storage string // "", "memory" or "file"
+	batch   string // --batch as given, for reports
+	cfg     exporterhelper.QueueBatchConfig
+	retry   configretry.BackOffConfig
+}
+
+// fileStorageID is the storage extension that file-backed queues use. The
+// exporter host provides it, so scenarios can refer to it too.
+var fileStorageID = component.MustNewID("file_storage")
+
+// parseQueueMode parses --queue (none, memory or file) and --batch (none,
+// items:N or bytes:N). Batching needs a queue, so --batch alone implies an
+// in-memory one. A positive retryInterval enables retry_on_failure with the
+// collector's defaults and that initial interval.
+func parseQueueMode(queue, batch string, retryInterval time.Duration) (queueMode, error) {
+	var q queueMode
+	if retryInterval > 0 {
+		q.retry = configretry.NewDefaultBackOffConfig()
+		q.retry.InitialInterval = retryInterval
+		if err := q.retry.Validate(); err != nil {
+			return queueMode{}, err
+		}
+	}
+	switch queue {
+	case "", "none":
+	case "memory", "file":
+		q.storage = queue
+	default:
+		return queueMode{}, fmt.Errorf("unknown queue %q (want none, memory or file)", queue)
+	}
+
+	q.cfg = exporterhelper.NewDefaultQueueConfig()
+	// Block rather than drop when the benchmark outruns the consumers.
+	q.cfg.BlockOnOverflow = true
+	if q.storage == "file" {
+		id := fileStorageID
+		q.cfg.StorageID = &id
+	}
+
+	if batch != "" && batch != "none" {
+		sizer, sizeStr, ok := strings.Cut(batch, ":")
+		size, err := strconv.ParseInt(sizeStr, 10, 64)
+		if !ok || err != nil || size <= 0 {
+			return queueMode{}, fmt.Errorf("invalid batch %q (want items:N or bytes:N)", batch)
+		}
+		bCfg := exporterhelper.BatchConfig{FlushTimeout: 200 * time.Millisecond, MinSize: size}
+		if err := bCfg.Sizer.UnmarshalText([]byte(sizer)); err != nil {
+			return queueMode{}, fmt.Errorf("invalid batch %q: %w", batch, err)
+		}
+		q.cfg.Batch = configoptional.Some(bCfg)
+		q.batch = batch
+		if q.storage == "" {
+			q.storage = "memory"
+		}
+	}
+	if err := xconfmap.Validate(&q.cfg); err != nil {
+		return queueMode{}, err
+	}
+	return q, nil
+}
+
+func (q queueMode) enabled() bool {
+	return q.storage != ""
+}
+
+// String describes the mode for reports, e.g. "file, batch items:8192". It
+// is empty when the queue is disabled.
+func (q queueMode) String() string {
+	if q.batch == "" {
+		return q.storage
+	}
+	return q.storage + ", batch " + q.batch
+}
+
+// sendingQueue returns the exporter sending_queue setting for the mode.
+func (q queueMode) sendingQueue() configoptional.Optional[exporterhelper.QueueBatchConfig] {
+	if !q.enabled() {
+		return configoptional.None[exporterhelper.QueueBatchConfig]()
+	}
+	return configoptional.Some(q.cfg)
+}
+
+// sendingQueueOf finds the sending_queue in an exporter config. Every
+// exporterhelper-based exporter embeds it as an optional QueueBatchConfig,
+// whatever the field is called.
+func sendingQueueOf(cfg component.Config) (exporterhelper.QueueBatchConfig, bool) {
+	v := reflect.Indirect(reflect.ValueOf(cfg))
+	if v.Kind() != reflect.Struct {
+		return exporterhelper.QueueBatchConfig{}, false
+	}
+	for i := range v.NumField() {
+		if !v.Type().Field(i).IsExported() {
+			continue
+		}
+		q, ok := v.Field(i).Interface().(configoptional.Optional[exporterhelper.QueueBatchConfig])
+		if ok && q.HasValue() {
+			return *q.Get(), true
+		}
+	}
+	return exporterhelper.QueueBatchConfig{}, false
+}
+
+// exporterHost is the component.Host exporters with a persistent queue
+// start with. It provides a file_storage extension backed by a temporary
+// directory. Other exporters start with a nop host.
+type exporterHost struct {
+	dir     string
+	storage extension.Extension
+}
+
+func startExporterHost(ctx context.Context) (*exporterHost, error) {
+	dir, err := os.MkdirTemp("", "exportbench-queue-")
+	if err != nil {
+		return nil, err
+	}
+	factory := filestorage.NewFactory()
+	cfg := factory.CreateDefaultConfig()
+	if err := confmap.NewFromStringMap(map[string]any{"directory": dir}).Unmarshal(cfg); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	set := extension.Settings{
+		ID:                fileStorageID,
+		TelemetrySettings: componenttest.NewNopTelemetrySettings(),
+		BuildInfo:         component.NewDefaultBuildInfo(),
+	}
+	ext, err := factory.Create(ctx, set, cfg)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("create file storage: %w", err)
+	}
+	if err := ext.Start(ctx, componenttest.NewNopHost()); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("start file storage: %w", err)
+	}
+	return &exporterHost{dir: dir, storage: ext}, nil
+}
+
+func (h *exporterHost) GetExtensions() map[component.ID]component.Component {
+	return map[component.ID]component.Component{fileStorageID: h.storage}
+}
+
+func (h *exporterHost) shutdown(ctx context.Context) error {
+	err := h.storage.Shutdown(ctx)
+	os.RemoveAll(h.dir)
+	return err
+}
+
+// drainTimeout bounds how long an iteration waits for a queue to empty.
+const drainTimeout = 2 * time.Minute
+
+// queueDrain makes an export with an asynchronous sending_queue wait until
+// the queue has sent everything, so that each iteration accounts for the
+// bytes and allocations of its own payloads. It counts exporterhelper's own
+// sent and failed items as they are recorded, through a meter provider that
+// feeds those two counters straight into the drain, so waiting neither
+// collects metrics nor polls.
+type queueDrain struct {
+	enqueued atomic.Int64
+	sent     atomic.Int64
+	failed   atomic.Int64
+	// progress is signalled whenever sent or failed grows.
+	progress chan struct{}
+	// lossy accepts failed items, which the caller counts as drops.
+	lossy bool
+}
+
+func newQueueDrain() *queueDrain {
+	return &queueDrain{progress: make(chan struct{}, 1)}
+}
+
+// instrument points the exporter's telemetry at the drain.
+func (d *queueDrain) instrument(set exporter.Settings) exporter.Settings {
+	set.TelemetrySettings.MeterProvider = drainMeterProvider{drain: d}
+	return set
+}
+
+// added records items accepted by the queue.
+func (d *queueDrain) added(items int) {
+	d.enqueued.Add(int64(items))
+}
+
+// counts returns the items the exporter has sent and failed to send so far.
+func (d *queueDrain) counts() (sent, failed int64) {
+	return d.sent.Load(), d.failed.Load()
+}
+
+// wait blocks until every enqueued item was sent or failed. Failed items
+// are dropped by the queue, so unless the drain is lossy they are reported
+// as an export error, as a synchronous exporter would.
+func (d *queueDrain) wait() error {
+	timeout := time.NewTimer(drainTimeout)
+	defer timeout.Stop()
+	for {
+		sent, failed := d.counts()
+		if want := d.enqueued.Load(); sent+failed >= want {
+			if failed > 0 && !d.lossy {
+				return fmt.Errorf("sending queue dropped %d of %d items", failed, want)
+			}
+			return nil
+		}
+		select {
+		case <-d.progress:
+		case <-timeout.C:
+			return fmt.Errorf("sending queue did not drain within %s: %d of %d items sent", drainTimeout, sent, d.enqueued.Load())
+		}
+	}
+}
+
+// drainMeterProvider gives exporterhelper no-op instruments, except for its
+// sent and send-failed item counters, which add to the drain.
+type drainMeterProvider struct {
+	noop.MeterProvider
+	drain *queueDrain
+}
+
+func (p drainMeterProvider) Meter(string, ...metric.MeterOption) metric.Meter {
+	return drainMeter{drain: p.drain}
+}
+
+type drainMeter struct {
+	noop.Meter
+	drain *queueDrain
+}
+
+func (m drainMeter) Int64Counter(name string, opts ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	switch {
+	case strings.HasPrefix(name, "otelcol_exporter_sent_"):
+		return drainCounter{total: &m.drain.sent, progress: m.drain.progress}, nil
+	case strings.HasPrefix(name, "otelcol_exporter_send_failed_"):
+		return drainCounter{total: &m.drain.failed, progress: m.drain.progress}, nil
+	}
+	return m.Meter.Int64Counter(name, opts...)
+}
+
+// drainCounter adds to one of the drain's totals and wakes its waiter.
+type drainCounter struct {
+	noop.Int64Counter
+	total    *atomic.Int64
+	progress chan struct{}
+}
+
+func (c drainCounter) Add(_ context.Context, incr int64, _ ...metric.AddOption) {
+	c.total.Add(incr)
+	select {
+	case c.progress <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+
+	"go.opentelemetry.io/collector/exporter/otlphttpexporter"
+)
+
+func TestParseQueueMode(t *testing.T) {
+	q, err := parseQueueMode("none", "none", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.enabled() || q.sendingQueue().HasValue() || q.String() != "" {
+		t.Errorf("none/none = %+v, want the queue disabled", q)
+	}
+
+	// Batching needs a queue and gets an in-memory one.
+	q, err = parseQueueMode("none", "items:5000", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := q.String(); got != "memory, batch items:5000" {
+		t.Errorf("String() = %q", got)
+	}
+	sq := q.sendingQueue()
+	cfg := sq.Get()
+	if cfg.StorageID != nil || !cfg.Batch.HasValue() || cfg.Batch.Get().MinSize != 5000 {
+		t.Errorf("queue config = %+v", cfg)
+	}
+
+	q, err = parseQueueMode("file", "bytes:1048576", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sq = q.sendingQueue()
+	if cfg := sq.Get(); cfg.StorageID == nil || *cfg.StorageID != fileStorageID {
+		t.Errorf("file queue storage = %v, want %v", cfg.StorageID, fileStorageID)
+	}
+
+	for _, bad := range [][2]string{{"disk", "none"}, {"memory", "items"}, {"memory", "requests:10"}, {"memory", "items:-1"}} {
+		if _, err := parseQueueMode(bad[0], bad[1], 0); err == nil {
+			t.Errorf("parseQueueMode(%q, %q) succeeded, want error", bad[0], bad[1])
+		}
+	}
+}
+
+func TestQueuedFormatDrains(t *testing.T) {
+	for _, mode := range []string{"memory", "file"} {
+		t.Run(mode, func(t *testing.T) {
+			q, err := parseQueueMode(mode, "none", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f := newHTTPFormat("queued", testSignal, testHTTPServer, otlphttpexporter.EncodingProto, codec{}, q)
+			if err := f.setup(); err != nil {
+				t.Fatal(err)
+			}
+			defer f.cleanup()
+
+			f.size()
+			if err := f.export(testPayloads); err != nil {
+				t.Fatal(err)
+			}
+			// Export returns once the queue has sent everything, so the
+			// server already saw every payload.
+			var want int64
+			for _, p := range testPayloads {
+				want += int64(len(p.raw))
+			}
+			if got := f.size(); got < want {
+				t.Errorf("server received %d bytes after export, want at least %d", got, want)
+			}
+		})
+	}
+}
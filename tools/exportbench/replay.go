@@ -0,0 +1,320 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+// replayMaxInFlight bounds the requests a replay has outstanding. A format
+// that cannot keep up falls behind schedule rather than piling up
+// goroutines, and the lag shows in its latency.
+const replayMaxInFlight = 256
+
+// replayMode is the offered load of --replay: the payloads' own timestamps,
+// optionally sped up, or a constant rate of items or raw bytes per second.
+type replayMode struct {
+	spec  string
+	speed float64
+	sizer string
+	rate  float64
+}
+
+func parseReplayMode(s string) (replayMode, error) {
+	m := replayMode{spec: s}
+	kind, arg, hasArg := strings.Cut(s, ":")
+	var err error
+	switch kind {
+	case "", "none":
+		return replayMode{}, nil
+	case "recorded":
+		m.speed = 1
+		if hasArg {
+			m.speed, err = strconv.ParseFloat(strings.TrimSuffix(arg, "x"), 64)
+		}
+		if err != nil || !positiveFinite(m.speed) {
+			return replayMode{}, fmt.Errorf("invalid replay %q (want a positive speed-up, e.g. recorded:10x)", s)
+		}
+	case "items":
+		m.sizer = kind
+		m.rate, err = strconv.ParseFloat(arg, 64)
+	case "bytes":
+		m.sizer = kind
+		var n int64
+		n, err = parseByteSize(arg)
+		m.rate = float64(n)
+	default:
+		return replayMode{}, fmt.Errorf("unknown replay %q (want recorded[:SPEED], items:N or bytes:SIZE per second)", s)
+	}
+	if m.sizer != "" && (err != nil || !positiveFinite(m.rate)) {
+		return replayMode{}, fmt.Errorf("invalid replay %q (want a positive rate per second)", s)
+	}
+	return m, nil
+}
+
+// positiveFinite rejects the NaN and Inf that strconv.ParseFloat accepts.
+func positiveFinite(v float64) bool {
+	return v > 0 && !math.IsInf(v, 1)
+}
+
+func (m replayMode) enabled() bool { return m.spec != "" }
+
+func (m replayMode) String() string { return m.spec }
+
+// replayEvent is one request of a replay and when to send it, relative to
+// the start.
+type replayEvent struct {
+	at time.Duration
+	p  payload
+}
+
+// schedule lays the payloads out in time. Recorded timing sends each payload
+// at its latest timestamp relative to the earliest payload; a payload
+// without timestamps goes out with the one before it. A rate spaces them by
+// their items or raw bytes.
+func (m replayMode) schedule(payloads []payload) ([]replayEvent, error) {
+	events := make([]replayEvent, len(payloads))
+	if m.sizer != "" {
+		var sent float64
+		for i, p := range payloads {
+			events[i] = replayEvent{at: time.Duration(sent / m.rate * float64(time.Second)), p: p}
+			if m.sizer == "items" {
+				sent += float64(p.itemCount())
+			} else {
+				sent += float64(len(p.raw))
+			}
+		}
+		return events, nil
+	}
+
+	times := make([]pcommon.Timestamp, len(payloads))
+	var first, last pcommon.Timestamp
+	for i, p := range payloads {
+		times[i] = payloadTime(p)
+		if times[i] == 0 {
+			continue
+		}
+		if first == 0 || times[i] < first {
+			first = times[i]
+		}
+		last = max(last, times[i])
+	}
+	if first == last {
+		return nil, errors.New("the payloads carry no distinct timestamps to replay, use items:N or bytes:SIZE")
+	}
+	// Undated payloads would otherwise be sent decades before the rest.
+	prev := first
+	for i, ts := range times {
+		if ts == 0 {
+			times[i] = prev
+		}
+		prev = times[i]
+	}
+	for i, p := range payloads {
+		offset := float64(times[i]-first) / m.speed
+		events[i] = replayEvent{at: time.Duration(offset), p: p}
+	}
+	slices.SortStableFunc(events, func(a, b replayEvent) int {
+		return cmp.Compare(a.at, b.at)
+	})
+	return events, nil
+}
+
+// payloadTime is the latest timestamp in a payload: data point, log record
+// (observed, if unset), span end or profile time. It approximates when the
+// request left the pipeline that produced it.
+func payloadTime(p payload) pcommon.Timestamp {
+	var latest pcommon.Timestamp
+	see := func(ts pcommon.Timestamp) { latest = max(latest, ts) }
+	switch p.signal {
+	case signalMetrics:
+		for _, rm := range p.metrics.Metrics().ResourceMetrics().All() {
+			for _, sm := range rm.ScopeMetrics().All() {
+				for _, m := range sm.Metrics().All() {
+					metricTimes(m, see)
+				}
+			}
+		}
+	case signalLogs:
+		for _, rl := range p.logs.Logs().ResourceLogs().All() {
+			for _, sl := range rl.ScopeLogs().All() {
+				for _, lr := range sl.LogRecords().All() {
+					if ts := lr.Timestamp(); ts != 0 {
+						see(ts)
+					} else {
+						see(lr.ObservedTimestamp())
+					}
+				}
+			}
+		}
+	case signalTraces:
+		for _, rs := range p.traces.Traces().ResourceSpans().All() {
+			for _, ss := range rs.ScopeSpans().All() {
+				for _, span := range ss.Spans().All() {
+					see(span.EndTimestamp())
+				}
+			}
+		}
+	case signalProfiles:
+		for _, rp := range p.profiles.Profiles().ResourceProfiles().All() {
+			for _, sp := range rp.ScopeProfiles().All() {
+				for _, prof := range sp.Profiles().All() {
+					see(prof.Time())
+				}
+			}
+		}
+	}
+	return latest
+}
+
+func metricTimes(m pmetric.Metric, see func(pcommon.Timestamp)) {
+	switch m.Type() {
+	case pmetric.MetricTypeGauge:
+		for _, dp := range m.Gauge().DataPoints().All() {
+			see(dp.Timestamp())
+		}
+	case pmetric.MetricTypeSum:
+		for _, dp := range m.Sum().DataPoints().All() {
+			see(dp.Timestamp())
+		}
+	case pmetric.MetricTypeHistogram:
+		for _, dp := range m.Histogram().DataPoints().All() {
+			see(dp.Timestamp())
+		}
+	case pmetric.MetricTypeExponentialHistogram:
+		for _, dp := range m.ExponentialHistogram().DataPoints().All() {
+			see(dp.Timestamp())
+		}
+	case pmetric.MetricTypeSummary:
+		for _, dp := range m.Summary().DataPoints().All() {
+			see(dp.Timestamp())
+		}
+	}
+}
+
+// replayResult is what a format cost while the replay offered it a fixed
+// load. Like the timed iterations, CPU and memory are process-wide and
+// include the nop servers.
+type replayResult struct {
+	elapsed    time.Duration
+	cpu        time.Duration
+	allocBytes int64
+	heap       heapGrowth
+	// latencies are measured from when each request was due, not when it
+	// was sent, so that falling behind schedule counts against the format.
+	latencies []time.Duration
+	maxLag    time.Duration
+}
+
+// runReplay sends every event at its time, each request on its own, without
+// waiting for earlier requests to complete, the way independent pipelines
+// feed an exporter.
+func runReplay(f benchFormat, events []replayEvent) (replayResult, error) {
+	var res replayResult
+	res.latencies = make([]time.Duration, len(events))
+	errs := make([]error, len(events))
+	inFlight := make(chan struct{}, replayMaxInFlight)
+	var wg sync.WaitGroup
+
+	heap := startHeapSampler()
+	var memBefore, memAfter runtime.MemStats
+	runtime.ReadMemStats(&memBefore)
+	cpuStart := processCPUTime()
+	start := time.Now()
+	for i, ev := range events {
+		due := start.Add(ev.at)
+		time.Sleep(time.Until(due))
+		inFlight <- struct{}{}
+		res.maxLag = max(res.maxLag, time.Since(due))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = f.export([]payload{ev.p})
+			res.latencies[i] = time.Since(due)
+			<-inFlight
+		}()
+	}
+	wg.Wait()
+	res.elapsed = time.Since(start)
+	res.cpu = processCPUTime() - cpuStart
+	runtime.ReadMemStats(&memAfter)
+	res.allocBytes = int64(memAfter.TotalAlloc - memBefore.TotalAlloc)
+	res.heap = heap.stop()
+
+	for i, err := range errs {
+		if err != nil {
+			return replayResult{}, fmt.Errorf("%s: %w", events[i].p.filename, err)
+		}
+	}
+	return res, nil
+}
+
+// replayLoad is the load a replay offered every format.
+type replayLoad struct {
+	Mode           string  `json:"mode"`
+	DurationNs     int64   `json:"duration_ns"`
+	Requests       int     `json:"requests"`
+	ItemsPerSec    float64 `json:"items_per_sec"`
+	RawBytesPerSec float64 `json:"raw_bytes_per_sec"`
+}
+
+func newReplayLoad(m replayMode, events []replayEvent, ds datasetSummary) *replayLoad {
+	l := &replayLoad{Mode: m.String(), Requests: len(events)}
+	// A rate also paces the last request's items or bytes.
+	switch {
+	case m.sizer == "items":
+		l.DurationNs = int64(float64(ds.Items) / m.rate * float64(time.Second))
+	case m.sizer == "bytes":
+		l.DurationNs = int64(float64(ds.RawBytes) / m.rate * float64(time.Second))
+	case len(events) > 1:
+		// Recorded timing: count the last request as one mean gap long.
+		n := int64(len(events))
+		l.DurationNs = events[n-1].at.Nanoseconds() * n / (n - 1)
+	}
+	if secs := time.Duration(l.DurationNs).Seconds(); secs > 0 {
+		l.ItemsPerSec = float64(ds.Items) / secs
+		l.RawBytesPerSec = float64(ds.RawBytes) / secs
+	}
+	return l
+}
+
+// replayRecord is the serialized form of a replayResult. CPU is in cores,
+// i.e. CPU seconds per second of replay.
+type replayRecord struct {
+	ElapsedNs           int64        `json:"elapsed_ns"`
+	CPUCores            float64      `json:"cpu_cores"`
+	AllocBytesPerSec    float64      `json:"alloc_bytes_per_sec"`
+	MeanHeapGrowthBytes int64        `json:"mean_heap_growth_bytes"`
+	PeakHeapGrowthBytes int64        `json:"peak_heap_growth_bytes"`
+	Latency             distribution `json:"latency_ns"`
+	MaxLagNs            int64        `json:"max_lag_ns"`
+}
+
+func newReplayRecord(r replayResult) *replayRecord {
+	rec := &replayRecord{
+		ElapsedNs:           r.elapsed.Nanoseconds(),
+		MeanHeapGrowthBytes: r.heap.mean,
+		PeakHeapGrowthBytes: r.heap.peak,
+		MaxLagNs:            r.maxLag.Nanoseconds(),
+	}
+	if secs := r.elapsed.Seconds(); secs > 0 {
+		rec.CPUCores = r.cpu.Seconds() / secs
+		rec.AllocBytesPerSec = float64(r.allocBytes) / secs
+	}
+	latencies := make([]float64, len(r.latencies))
+	for i, l := range r.latencies {
+		latencies[i] = float64(l.Nanoseconds())
+	}
+	rec.Latency = summarize(latencies)
+	return rec
+}
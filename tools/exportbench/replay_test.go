@@ -0,0 +1,119 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/exporter/otlphttpexporter"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+)
+
+func TestParseReplayMode(t *testing.T) {
+	for _, tt := range []struct {
+		spec  string
+		speed float64
+		sizer string
+		rate  float64
+	}{
+		{spec: "recorded", speed: 1},
+		{spec: "recorded:10x", speed: 10},
+		{spec: "recorded:0.5", speed: 0.5},
+		{spec: "items:5000", sizer: "items", rate: 5000},
+		{spec: "bytes:2MiB", sizer: "bytes", rate: 2 << 20},
+	} {
+		m, err := parseReplayMode(tt.spec)
+		if err != nil {
+			t.Errorf("%s: %v", tt.spec, err)
+			continue
+		}
+		if m.speed != tt.speed || m.sizer != tt.sizer || m.rate != tt.rate || !m.enabled() {
+			t.Errorf("%s = %+v", tt.spec, m)
+		}
+	}
+	for _, spec := range []string{"recorded:0", "recorded:NaN", "recorded:Inf", "items", "items:-1", "items:NaN", "items:+Inf", "bytes:x", "fast"} {
+		if _, err := parseReplayMode(spec); err == nil {
+			t.Errorf("%s: no error", spec)
+		}
+	}
+	if m, err := parseReplayMode(""); err != nil || m.enabled() {
+		t.Errorf("empty spec = %+v, %v", m, err)
+	}
+}
+
+func TestReplaySchedule(t *testing.T) {
+	payloads, _, err := generatePayloads(defaultSyntheticConfig(), signalMetrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The synthetic files are 10s apart.
+	m, _ := parseReplayMode("recorded:100x")
+	events, err := m.schedule(payloads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, ev := range events {
+		if want := time.Duration(i) * 100 * time.Millisecond; ev.at != want || ev.p.filename != payloads[i].filename {
+			t.Errorf("event %d: %s at %s, want %s at %s", i, ev.p.filename, ev.at, payloads[i].filename, want)
+		}
+	}
+	if _, err := m.schedule(payloads[:1]); err == nil {
+		t.Error("a single timestamp was scheduled")
+	}
+
+	// A payload without timestamps goes out with the one before it rather
+	// than decades early.
+	undated := payload{filename: "undated", signal: signalMetrics, metrics: pmetricotlp.NewExportRequest()}
+	events, err = m.schedule([]payload{payloads[0], payloads[1], undated, payloads[2]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev := events[2]; ev.p.filename != "undated" || ev.at != 100*time.Millisecond {
+		t.Errorf("undated payload: %s at %s, want at 100ms", ev.p.filename, ev.at)
+	}
+	if ev := events[3]; ev.at != 200*time.Millisecond {
+		t.Errorf("last payload at %s, want 200ms", ev.at)
+	}
+
+	items := payloads[0].itemCount()
+	m, _ = parseReplayMode("items:1000")
+	events, err = m.schedule(payloads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Duration(items) * time.Millisecond; events[1].at != want {
+		t.Errorf("second request at %s, want %s", events[1].at, want)
+	}
+	ds := datasetSummary{Items: items * len(payloads)}
+	if l := newReplayLoad(m, events, ds); l.ItemsPerSec != 1000 {
+		t.Errorf("offered %.0f items/s, want 1000", l.ItemsPerSec)
+	}
+}
+
+func TestRunReplay(t *testing.T) {
+	f := newHTTPFormat("replay", testSignal, testHTTPServer, otlphttpexporter.EncodingProto, codec{}, queueMode{})
+	if err := f.setup(); err != nil {
+		t.Fatal(err)
+	}
+	defer f.cleanup()
+	f.size()
+
+	events := make([]replayEvent, len(testPayloads))
+	for i, p := range testPayloads {
+		events[i] = replayEvent{at: time.Duration(i) * 5 * time.Millisecond, p: p}
+	}
+	res, err := runReplay(f, events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := events[len(events)-1].at; res.elapsed < last {
+		t.Errorf("replay took %s, faster than its schedule of %s", res.elapsed, last)
+	}
+	rec := newReplayRecord(res)
+	if rec.Latency.Min <= 0 || rec.CPUCores <= 0 {
+		t.Errorf("replay record = %+v", rec)
+	}
+	if got, want := f.size(), testTotalRawBytes; got != want {
+		t.Errorf("replay sent %d bytes, want %d", got, want)
+	}
+}
@@ -0,0 +1,948 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// report is the complete outcome of a benchmark run. Its JSON form is the
+// stable file format consumed by dashboards and regression checks.
+type report struct {
+	Timestamp   time.Time      `json:"timestamp"`
+	Iterations  int            `json:"iterations"`
+	Concurrency int            `json:"concurrency"`
+	Queue       string         `json:"queue,omitempty"`
+	Retry       string         `json:"retry,omitempty"`
+	Faults      string         `json:"faults,omitempty"`
+	TLS         bool           `json:"tls"`
+	Dataset     datasetSummary `json:"dataset"`
+	Environment environment    `json:"environment"`
+	Results     []resultRecord `json:"results"`
+	Files       []fileRecord   `json:"files,omitempty"`
+	Replay      *replayLoad    `json:"replay,omitempty"`
+	Soak        string         `json:"soak,omitempty"`
+	Isolated    bool           `json:"isolated"`
+}
+
+type datasetSummary struct {
+	Source   string `json:"source"`
+	Signal   signal `json:"signal"`
+	Files    int    `json:"files"`
+	RawBytes int64  `json:"raw_bytes"`
+	Items    int    `json:"items"`
+}
+
+type environment struct {
+	GoVersion       string `json:"go_version"`
+	GOOS            string `json:"goos"`
+	GOARCH          string `json:"goarch"`
+	GOMAXPROCS      int    `json:"gomaxprocs"`
+	NumCPU          int    `json:"num_cpu"`
+	CPUModel        string `json:"cpu_model,omitempty"`
+	HostFingerprint string `json:"host_fingerprint"`
+}
+
+// resultRecord is the serialized form of a formatResult. The scalar fields
+// are per-iteration means; the distributions and samples keep the spread.
+type resultRecord struct {
+	Format          string          `json:"format"`
+	Codec           string          `json:"codec"`
+	TotalBytes      int64           `json:"total_bytes"`
+	SocketBytesIn   int64           `json:"socket_bytes_in"`
+	SocketBytesOut  int64           `json:"socket_bytes_out"`
+	Ratio           float64         `json:"ratio"`
+	SerializeTimeNs int64           `json:"serialize_time_ns"`
+	CPUTimeNs       int64           `json:"cpu_time_ns"`
+	AllocBytes      int64           `json:"alloc_bytes"`
+	NumAllocs       int64           `json:"num_allocs"`
+	RawBytesPerSec  float64         `json:"raw_bytes_per_sec"`
+	ItemsPerSec     float64         `json:"items_per_sec"`
+	SerializeTime   distribution    `json:"serialize_time_stats"`
+	Allocs          distribution    `json:"allocs_stats"`
+	AllocBytesDist  distribution    `json:"alloc_bytes_stats"`
+	Noisy           bool            `json:"noisy"`
+	ServerDecode    *serverDecode   `json:"server_decode,omitempty"`
+	Verify          *verification   `json:"verify,omitempty"`
+	Delivery        *deliveryRecord `json:"delivery,omitempty"`
+	AllocProfile    *allocRecord    `json:"alloc_profile,omitempty"`
+	Replay          *replayRecord   `json:"replay,omitempty"`
+	Soak            *soakRecord     `json:"soak,omitempty"`
+	Memory          memoryRecord    `json:"memory"`
+	// PeakRSSBytes is the peak resident set of the format's child process,
+	// set only with --isolate.
+	PeakRSSBytes int64             `json:"peak_rss_bytes,omitempty"`
+	Samples      []iterationRecord `json:"samples"`
+}
+
+// memoryRecord is the footprint of a format over all timed iterations: the
+// peaks of the live heap, goroutine stacks and runtime-mapped memory, and
+// the garbage collections. Peaks are process-wide and include the dataset
+// and the nop servers; --isolate keeps earlier formats out of them.
+type memoryRecord struct {
+	PeakHeapBytes    int64 `json:"peak_heap_bytes"`
+	PeakStacksBytes  int64 `json:"peak_stacks_bytes"`
+	PeakRuntimeBytes int64 `json:"peak_runtime_bytes"`
+	GCCycles         int64 `json:"gc_cycles"`
+	GCPauseNs        int64 `json:"gc_pause_ns"`
+	GCPauseMaxNs     int64 `json:"gc_pause_max_ns"`
+}
+
+// deliveryRecord is how a format coped with --faults, per iteration.
+// Delivered items per second discounts dropped items from the throughput.
+type deliveryRecord struct {
+	DeliveredItemsPerSec    float64 `json:"delivered_items_per_sec"`
+	Retries                 float64 `json:"retries"`
+	DroppedItems            float64 `json:"dropped_items"`
+	RejectedRequests        float64 `json:"rejected_requests"`
+	ResetConnections        float64 `json:"reset_connections"`
+	WithheldAcks            float64 `json:"withheld_acks"`
+	PeakHeapGrowthBytes     int64   `json:"peak_heap_growth_bytes"`
+	RetainedHeapGrowthBytes int64   `json:"retained_heap_growth_bytes"`
+}
+
+// allocRecord is the --memprofile-dir summary of a format's sampled
+// allocations, per iteration. Unlike Allocs/op it is process-wide, so it
+// also counts the nop servers.
+type allocRecord struct {
+	Objects int64             `json:"objects"`
+	Bytes   int64             `json:"bytes"`
+	Sites   []allocSiteRecord `json:"top_sites"`
+}
+
+type allocSiteRecord struct {
+	Function string  `json:"function"`
+	Location string  `json:"location"`
+	Objects  int64   `json:"objects"`
+	Bytes    int64   `json:"bytes"`
+	Share    float64 `json:"share"`
+}
+
+// serverDecode splits the per-iteration cost of a --decode run into the part
+// spent by the servers decoding requests and the rest. The top-level
+// serialize time and allocations stay end-to-end.
+type serverDecode struct {
+	Requests     float64 `json:"requests"`
+	DecodeTimeNs int64   `json:"decode_time_ns"`
+	// DecodeCPUNs is the CPU time of the decoding threads, 0 where it
+	// cannot be read. DecodeTimeNs is wall time.
+	DecodeCPUNs int64 `json:"decode_cpu_ns"`
+	// Allocs and AllocBytes are everything the process allocated while a
+	// server was decoding, other goroutines included. The client figures
+	// are the rest of the iteration's allocations.
+	Allocs           int64        `json:"allocs"`
+	AllocBytes       int64        `json:"alloc_bytes"`
+	ClientAllocs     int64        `json:"client_allocs"`
+	ClientAllocBytes int64        `json:"client_alloc_bytes"`
+	DecodeTime       distribution `json:"decode_time_stats"`
+}
+
+type iterationRecord struct {
+	ElapsedNs        int64 `json:"elapsed_ns"`
+	CPUNs            int64 `json:"cpu_ns"`
+	Allocs           int64 `json:"allocs"`
+	AllocBytes       int64 `json:"alloc_bytes"`
+	DecodeNs         int64 `json:"decode_ns,omitempty"`
+	DecodeCPUNs      int64 `json:"decode_cpu_ns,omitempty"`
+	DecodeAllocs     int64 `json:"decode_allocs,omitempty"`
+	DecodeAllocBytes int64 `json:"decode_alloc_bytes,omitempty"`
+	Retries          int64 `json:"retries,omitempty"`
+	DroppedItems     int64 `json:"dropped_items,omitempty"`
+}
+
+// newReport converts results into their serialized form. A result is marked
+// noisy when its serialize time coefficient of variation exceeds cvWarn.
+func newReport(ds datasetSummary, iterations int, cvWarn float64, results []formatResult) report {
+	r := report{
+		Timestamp:   time.Now().UTC(),
+		Iterations:  iterations,
+		Concurrency: 1,
+		Dataset:     ds,
+		Environment: currentEnvironment(),
+	}
+	for _, res := range results {
+		rec := resultRecord{
+			Format:          res.name,
+			Codec:           res.codec.String(),
+			TotalBytes:      res.totalBytes,
+			SocketBytesIn:   res.socket.in,
+			SocketBytesOut:  res.socket.out,
+			SerializeTimeNs: res.serializeTime.Nanoseconds(),
+			AllocBytes:      res.allocBytes,
+			NumAllocs:       res.numAllocs,
+		}
+		// JSON cannot encode +Inf, so leave the ratio at zero when nothing
+		// reached the server.
+		if res.totalBytes > 0 {
+			rec.Ratio = float64(ds.RawBytes) / float64(res.totalBytes)
+		}
+		if secs := res.serializeTime.Seconds(); secs > 0 {
+			rec.RawBytesPerSec = float64(ds.RawBytes) / secs
+			rec.ItemsPerSec = float64(ds.Items) / secs
+		}
+
+		var times, allocs, allocBytes, decodeTimes []float64
+		var cpu time.Duration
+		for _, s := range res.samples {
+			cpu += s.cpu
+			rec.Samples = append(rec.Samples, iterationRecord{
+				ElapsedNs:        s.elapsed.Nanoseconds(),
+				CPUNs:            s.cpu.Nanoseconds(),
+				Allocs:           s.allocs,
+				AllocBytes:       s.allocBytes,
+				DecodeNs:         s.decode.elapsed.Nanoseconds(),
+				DecodeCPUNs:      s.decode.cpu.Nanoseconds(),
+				DecodeAllocs:     s.decode.allocs,
+				DecodeAllocBytes: s.decode.allocBytes,
+				Retries:          s.delivery.retries,
+				DroppedItems:     s.delivery.dropped,
+			})
+			times = append(times, float64(s.elapsed.Nanoseconds()))
+			allocs = append(allocs, float64(s.allocs))
+			allocBytes = append(allocBytes, float64(s.allocBytes))
+			decodeTimes = append(decodeTimes, float64(s.decode.elapsed.Nanoseconds()))
+		}
+		if len(res.samples) > 0 {
+			rec.CPUTimeNs = cpu.Nanoseconds() / int64(len(res.samples))
+		}
+		rec.SerializeTime = summarize(times)
+		rec.Allocs = summarize(allocs)
+		rec.AllocBytesDist = summarize(allocBytes)
+		rec.Noisy = rec.SerializeTime.CV > cvWarn
+
+		if d := res.decode; d != nil {
+			rec.ServerDecode = &serverDecode{
+				Requests:         d.requests,
+				DecodeTimeNs:     d.elapsed.Nanoseconds(),
+				DecodeCPUNs:      d.cpu.Nanoseconds(),
+				Allocs:           d.allocs,
+				AllocBytes:       d.allocBytes,
+				ClientAllocs:     res.numAllocs - d.allocs,
+				ClientAllocBytes: res.allocBytes - d.allocBytes,
+				DecodeTime:       summarize(decodeTimes),
+			}
+		}
+		rec.Verify = res.verify
+		if d := res.delivery; d != nil {
+			rec.Delivery = &deliveryRecord{
+				Retries:                 d.retries,
+				DroppedItems:            d.dropped,
+				RejectedRequests:        d.rejected,
+				ResetConnections:        d.resets,
+				WithheldAcks:            d.withheldAcks,
+				PeakHeapGrowthBytes:     d.heap.peak,
+				RetainedHeapGrowthBytes: d.heap.retained,
+			}
+			if secs := res.serializeTime.Seconds(); secs > 0 {
+				rec.Delivery.DeliveredItemsPerSec = (float64(ds.Items) - d.dropped) / secs
+			}
+		}
+
+		if a := res.allocs; a != nil && iterations > 0 {
+			n := int64(iterations)
+			rec.AllocProfile = &allocRecord{Objects: a.objects / n, Bytes: a.bytes / n, Sites: []allocSiteRecord{}}
+			for _, site := range a.sites {
+				sr := allocSiteRecord{
+					Function: site.function,
+					Location: site.shortLocation(),
+					Objects:  site.objects / n,
+					Bytes:    site.bytes / n,
+				}
+				if a.bytes > 0 {
+					sr.Share = float64(site.bytes) / float64(a.bytes)
+				}
+				rec.AllocProfile.Sites = append(rec.AllocProfile.Sites, sr)
+			}
+		}
+
+		if res.replay != nil {
+			rec.Replay = newReplayRecord(*res.replay)
+		}
+		if res.soak != nil {
+			rec.Soak = newSoakRecord(*res.soak)
+		}
+		m := res.memory
+		rec.Memory = memoryRecord{
+			PeakHeapBytes:    m.heap,
+			PeakStacksBytes:  m.stacks,
+			PeakRuntimeBytes: m.runtime,
+			GCCycles:         m.gcs,
+			GCPauseNs:        m.gcPause.Nanoseconds(),
+			GCPauseMaxNs:     m.gcPauseMax.Nanoseconds(),
+		}
+
+		r.Results = append(r.Results, rec)
+	}
+	return r
+}
+
+func currentEnvironment() environment {
+	env := environment{
+		GoVersion:  runtime.Version(),
+		GOOS:       runtime.GOOS,
+		GOARCH:     runtime.GOARCH,
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		NumCPU:     runtime.NumCPU(),
+		CPUModel:   cpuModel(),
+	}
+	hostname, _ := os.Hostname()
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		hostname, env.GOOS, env.GOARCH, strconv.Itoa(env.NumCPU), env.CPUModel,
+	}, "|")))
+	env.HostFingerprint = hex.EncodeToString(sum[:8])
+	return env
+}
+
+// cpuModel returns the CPU model name on Linux and "" elsewhere.
+func cpuModel() string {
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if ok && strings.TrimSpace(key) == "model name" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+func writeReport(w io.Writer, r report, format string) error {
+	switch format {
+	case "markdown":
+		return writeMarkdown(w, r)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case "csv":
+		return writeCSV(w, r)
+	default:
+		return fmt.Errorf("unknown output format %q (want markdown, json or csv)", format)
+	}
+}
+
+func writeMarkdown(w io.Writer, r report) error {
+	ds := r.Dataset
+	fmt.Fprintln(w, "## Dataset")
+	fmt.Fprintf(w, "- Files: %d\n", ds.Files)
+	fmt.Fprintf(w, "- Total raw protobuf: %.1f MB\n", float64(ds.RawBytes)/1024/1024)
+	fmt.Fprintf(w, "- Signal: %s\n", ds.Signal)
+	fmt.Fprintf(w, "- Total %s: %d\n", ds.Signal.itemName(), ds.Items)
+	if r.Queue != "" {
+		fmt.Fprintf(w, "- Sending queue: %s\n", r.Queue)
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintf(w, "## Results (avg over %d iterations)\n\n", r.Iterations)
+	fmt.Fprintln(w, "| Format | Total Size | Ratio vs Raw | Serialize Time | Allocs/op | Bytes/op |")
+	fmt.Fprintln(w, "|--------|-----------|--------------|----------------|-----------|----------|")
+	for _, res := range r.Results {
+		_, err := fmt.Fprintf(w, "| %-22s | %8.1f MB | %10.2fx | %12s | %9d | %8.1f MB |\n",
+			res.Format,
+			float64(res.TotalBytes)/1024/1024,
+			res.Ratio,
+			time.Duration(res.SerializeTimeNs).Round(time.Microsecond),
+			res.NumAllocs,
+			float64(res.AllocBytes)/1024/1024,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(w, "\n## Per-iteration distribution\n\n")
+	fmt.Fprintln(w, "| Format | Min | p50 | p90 | p99 | Max | Stddev | 95% CI | CV | Allocs/op p50 | Allocs/op max |")
+	fmt.Fprintln(w, "|--------|-----|-----|-----|-----|-----|--------|--------|----|---------------|---------------|")
+	for _, res := range r.Results {
+		t := res.SerializeTime
+		cv := fmt.Sprintf("%.1f%%", t.CV*100)
+		if res.Noisy {
+			cv += " (noisy)"
+		}
+		_, err := fmt.Fprintf(w, "| %-22s | %s | %s | %s | %s | %s | %s | %s..%s | %s | %.0f | %.0f |\n",
+			res.Format,
+			fmtNs(t.Min), fmtNs(t.P50), fmtNs(t.P90), fmtNs(t.P99), fmtNs(t.Max),
+			fmtNs(t.Stddev), fmtNs(t.CI95Low), fmtNs(t.CI95High),
+			cv,
+			res.Allocs.P50,
+			res.Allocs.Max,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := writeMemoryMarkdown(w, r); err != nil {
+		return err
+	}
+	if err := writeSocketMarkdown(w, r); err != nil {
+		return err
+	}
+	if err := writeCodecMarkdown(w, r); err != nil {
+		return err
+	}
+	if err := writeDecodeMarkdown(w, r); err != nil {
+		return err
+	}
+	if err := writeVerifyMarkdown(w, r); err != nil {
+		return err
+	}
+	if err := writeDeliveryMarkdown(w, r); err != nil {
+		return err
+	}
+	if err := writeAllocSitesMarkdown(w, r); err != nil {
+		return err
+	}
+	if err := writePerFileMarkdown(w, r); err != nil {
+		return err
+	}
+	if err := writeReplayMarkdown(w, r); err != nil {
+		return err
+	}
+	if err := writeSoakMarkdown(w, r); err != nil {
+		return err
+	}
+	if err := writeIsolatedMarkdown(w, r); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\n## Throughput (concurrency %d)\n\n", r.Concurrency)
+	fmt.Fprintf(w, "| Format | Raw MB/s | %s/s |\n", ds.Signal.itemName())
+	fmt.Fprintln(w, "|--------|----------|------|")
+	for _, res := range r.Results {
+		_, err := fmt.Fprintf(w, "| %-22s | %8.1f | %10.0f |\n",
+			res.Format,
+			res.RawBytesPerSec/1024/1024,
+			res.ItemsPerSec,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeMemoryMarkdown sets the footprint of each format against its churn:
+// Bytes/op in the results is allocated bytes, which the garbage collector
+// mostly reclaims, while the peaks are what a memory limit has to fit.
+func writeMemoryMarkdown(w io.Writer, r report) error {
+	if len(r.Results) == 0 {
+		return nil
+	}
+	fmt.Fprintf(w, "\n## Memory high-water mark (all %d iterations)\n\n", r.Iterations)
+	fmt.Fprintln(w, "| Format | Peak live heap | Peak stacks | Peak Go runtime | GC cycles | GC pause total | Max GC pause |")
+	fmt.Fprintln(w, "|--------|----------------|-------------|-----------------|-----------|----------------|--------------|")
+	for _, res := range r.Results {
+		m := res.Memory
+		_, err := fmt.Fprintf(w, "| %-22s | %.1f MB | %.1f MB | %.1f MB | %d | %s | %s |\n",
+			res.Format,
+			float64(m.PeakHeapBytes)/1024/1024,
+			float64(m.PeakStacksBytes)/1024/1024,
+			float64(m.PeakRuntimeBytes)/1024/1024,
+			m.GCCycles, fmtNs(float64(m.GCPauseNs)), fmtNs(float64(m.GCPauseMaxNs)))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSocketMarkdown sets the payload bytes against what crossed the
+// sockets, which adds gRPC and HTTP/2 framing, HTTP headers, responses and,
+// with --tls, TLS records.
+func writeSocketMarkdown(w io.Writer, r report) error {
+	transport := "plaintext"
+	if r.TLS {
+		transport = "TLS"
+	}
+	fmt.Fprintf(w, "\n## Socket bytes (%s)\n\n", transport)
+	fmt.Fprintln(w, "| Format | Payload | Socket in | Socket out | Overhead in | Ratio vs Raw (socket) |")
+	fmt.Fprintln(w, "|--------|---------|-----------|------------|-------------|-----------------------|")
+	for _, res := range r.Results {
+		overhead, ratio := "n/a", "n/a"
+		if res.TotalBytes > 0 {
+			overhead = fmt.Sprintf("%+.1f%%", float64(res.SocketBytesIn-res.TotalBytes)/float64(res.TotalBytes)*100)
+		}
+		if res.SocketBytesIn > 0 {
+			ratio = fmt.Sprintf("%.2fx", float64(r.Dataset.RawBytes)/float64(res.SocketBytesIn))
+		}
+		_, err := fmt.Fprintf(w, "| %-22s | %8.1f MB | %8.1f MB | %8.1f KB | %10s | %10s |\n",
+			res.Format,
+			float64(res.TotalBytes)/1024/1024,
+			float64(res.SocketBytesIn)/1024/1024,
+			float64(res.SocketBytesOut)/1024,
+			overhead,
+			ratio,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeCodecMarkdown sets the compression achieved by each format against the
+// CPU it cost. CPU time is process-wide, so it includes the nop servers and
+// the garbage collector.
+func writeCodecMarkdown(w io.Writer, r report) error {
+	fmt.Fprintf(w, "\n## CPU time vs ratio\n\n")
+	fmt.Fprintln(w, "| Format | Codec | Ratio vs Raw | CPU time/op | CPU per raw MB | Wall time/op |")
+	fmt.Fprintln(w, "|--------|-------|--------------|-------------|----------------|--------------|")
+	rawMB := float64(r.Dataset.RawBytes) / 1024 / 1024
+	for _, res := range r.Results {
+		var perMB time.Duration
+		if rawMB > 0 {
+			perMB = time.Duration(float64(res.CPUTimeNs) / rawMB)
+		}
+		_, err := fmt.Fprintf(w, "| %-22s | %-7s | %10.2fx | %12s | %12s | %12s |\n",
+			res.Format,
+			res.Codec,
+			res.Ratio,
+			time.Duration(res.CPUTimeNs).Round(time.Microsecond),
+			perMB.Round(time.Microsecond),
+			time.Duration(res.SerializeTimeNs).Round(time.Microsecond),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeDecodeMarkdown writes the server-side decode split of a --decode run
+// and nothing otherwise.
+func writeDecodeMarkdown(w io.Writer, r report) error {
+	if len(r.Results) == 0 || r.Results[0].ServerDecode == nil {
+		return nil
+	}
+	fmt.Fprintf(w, "\n## Server-side decode\n\n")
+	fmt.Fprintln(w, "| Format | End-to-end | Decode wall | Decode CPU | Decode share | Allocs/op during decode ~ | Bytes/op during decode ~ | Other allocs/op ~ | Other bytes/op ~ |")
+	fmt.Fprintln(w, "|--------|------------|-------------|------------|--------------|---------------------------|--------------------------|-------------------|------------------|")
+	for _, res := range r.Results {
+		d := res.ServerDecode
+		if d == nil {
+			continue
+		}
+		var share float64
+		if res.SerializeTimeNs > 0 {
+			share = float64(d.DecodeTimeNs) / float64(res.SerializeTimeNs) * 100
+		}
+		_, err := fmt.Fprintf(w, "| %-22s | %12s | %12s | %12s | %11.1f%% | %9d | %8.1f MB | %9d | %8.1f MB |\n",
+			res.Format,
+			time.Duration(res.SerializeTimeNs).Round(time.Microsecond),
+			time.Duration(d.DecodeTimeNs).Round(time.Microsecond),
+			time.Duration(d.DecodeCPUNs).Round(time.Microsecond),
+			share,
+			d.Allocs,
+			float64(d.AllocBytes)/1024/1024,
+			d.ClientAllocs,
+			float64(d.ClientAllocBytes)/1024/1024,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w, "\nDecode wall is the time the servers spent decoding, descheduled time included; decode CPU is the decoding threads' own CPU time. "+
+		"Allocations during decode are read from process-wide counters around each decode, so they include whatever other goroutines, "+
+		"such as the client, the exporter's queue or other servers, allocated meanwhile; other allocations are the rest of the iteration's.")
+	return err
+}
+
+// writeVerifyMarkdown writes the round-trip check of a --verify run and
+// nothing otherwise.
+func writeVerifyMarkdown(w io.Writer, r report) error {
+	if len(r.Results) == 0 || r.Results[0].Verify == nil {
+		return nil
+	}
+	fmt.Fprintf(w, "\n## Fidelity\n\n")
+	fmt.Fprintf(w, "| Format | %s sent | Lost %s | Lost attributes | Lost exemplars | Mismatched | Result |\n",
+		r.Dataset.Signal.itemName(), r.Dataset.Signal.itemName())
+	fmt.Fprintln(w, "|--------|------|------|-----------------|----------------|------------|--------|")
+	for _, res := range r.Results {
+		v := res.Verify
+		if v == nil {
+			continue
+		}
+		lost := v.lost()
+		mismatched := fmt.Sprintf("%d %s", v.Mismatched, v.unit(r.Dataset.Signal))
+		result := "ok"
+		if !v.ok() {
+			result = "FAIL"
+			if v.FirstDiff != "" {
+				result += ": " + v.FirstDiff
+			}
+		}
+		_, err := fmt.Fprintf(w, "| %-22s | %d | %d | %d | %d | %s | %s |\n",
+			res.Format, v.Sent.Items, lost.Items, lost.Attributes, lost.Exemplars, mismatched, result)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeDeliveryMarkdown writes how each format coped with a --faults run and
+// nothing otherwise.
+func writeDeliveryMarkdown(w io.Writer, r report) error {
+	if len(r.Results) == 0 || r.Results[0].Delivery == nil {
+		return nil
+	}
+	retry := "off"
+	if r.Retry != "" {
+		retry = "initial interval " + r.Retry
+	}
+	fmt.Fprintf(w, "\n## Degraded downstream\n\n")
+	fmt.Fprintf(w, "Faults: `%s`, retry: %s\n\n", r.Faults, retry)
+	fmt.Fprintf(w, "| Format | Delivered %s/s | Retries | Dropped %s | Rejected | Resets | Withheld ACKs | Peak heap growth | Retained heap growth |\n",
+		r.Dataset.Signal.itemName(), r.Dataset.Signal.itemName())
+	fmt.Fprintln(w, "|--------|------|---------|------|----------|--------|---------------|------------------|----------------------|")
+	for _, res := range r.Results {
+		d := res.Delivery
+		if d == nil {
+			continue
+		}
+		_, err := fmt.Fprintf(w, "| %-22s | %10.0f | %.1f | %.1f | %.1f | %.1f | %.1f | %.1f MB | %.1f MB |\n",
+			res.Format, d.DeliveredItemsPerSec, d.Retries, d.DroppedItems, d.RejectedRequests,
+			d.ResetConnections, d.WithheldAcks,
+			float64(d.PeakHeapGrowthBytes)/1024/1024, float64(d.RetainedHeapGrowthBytes)/1024/1024)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeAllocSitesMarkdown writes the top allocation sites of each format in
+// --memprofile-dir mode and nothing otherwise.
+func writeAllocSitesMarkdown(w io.Writer, r report) error {
+	if len(r.Results) == 0 || r.Results[0].AllocProfile == nil {
+		return nil
+	}
+	fmt.Fprintf(w, "\n## Top allocation sites (sampled, per iteration)\n\n")
+	fmt.Fprintln(w, "| Format | Site | Location | Allocs/op | Bytes/op | Share |")
+	fmt.Fprintln(w, "|--------|------|----------|-----------|----------|-------|")
+	for _, res := range r.Results {
+		a := res.AllocProfile
+		if a == nil {
+			continue
+		}
+		for _, site := range a.Sites {
+			_, err := fmt.Fprintf(w, "| %-22s | `%s` | %s | %9d | %8.1f MB | %4.1f%% |\n",
+				res.Format, site.Function, site.Location, site.Objects,
+				float64(site.Bytes)/1024/1024, site.Share*100)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writePerFileMarkdown writes the --per-file table and nothing otherwise.
+func writePerFileMarkdown(w io.Writer, r report) error {
+	if len(r.Files) == 0 {
+		return nil
+	}
+	fmt.Fprintf(w, "\n## Per file (wire KB)\n\n")
+	header := []string{"File", "Raw KB", r.Dataset.Signal.itemName()}
+	for _, res := range r.Results {
+		header = append(header, res.Format)
+	}
+	header = append(header, "Best", "Best ratio")
+	fmt.Fprintf(w, "| %s |\n", strings.Join(header, " | "))
+	fmt.Fprintf(w, "|%s\n", strings.Repeat("------|", len(header)))
+
+	wins := map[string]int{}
+	for _, f := range r.Files {
+		row := []string{f.File, fmt.Sprintf("%.1f", float64(f.RawBytes)/1024), fmt.Sprint(f.Items)}
+		for _, res := range r.Results {
+			if slices.Contains(f.Dropped, res.Format) {
+				row = append(row, "dropped")
+				continue
+			}
+			row = append(row, fmt.Sprintf("%.1f", float64(f.WireBytes[res.Format])/1024))
+		}
+		best := "n/a"
+		if f.BestFormat != "" {
+			best = fmt.Sprintf("%.2fx", f.BestRatio)
+			wins[f.BestFormat]++
+		}
+		row = append(row, f.BestFormat, best)
+		if _, err := fmt.Fprintf(w, "| %s |\n", strings.Join(row, " | ")); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(w, "\nBest format by file:")
+	sep := " "
+	for _, res := range r.Results {
+		if n := wins[res.Format]; n > 0 {
+			fmt.Fprintf(w, "%s%s %d", sep, res.Format, n)
+			sep = ", "
+		}
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+// writeReplayMarkdown writes the --replay table and nothing otherwise.
+func writeReplayMarkdown(w io.Writer, r report) error {
+	l := r.Replay
+	if l == nil {
+		return nil
+	}
+	fmt.Fprintf(w, "\n## Replay (%s)\n\n", l.Mode)
+	fmt.Fprintf(w, "Offered load: %d requests over %s, %.0f %s/s, %.2f MB/s raw\n\n",
+		l.Requests, time.Duration(l.DurationNs).Round(time.Millisecond),
+		l.ItemsPerSec, r.Dataset.Signal.itemName(), l.RawBytesPerSec/1024/1024)
+	fmt.Fprintln(w, "| Format | CPU cores | Alloc MB/s | Mean heap growth | Peak heap growth | Latency p50 | p99 | Max | Max lag |")
+	fmt.Fprintln(w, "|--------|-----------|------------|------------------|------------------|-------------|-----|-----|---------|")
+	for _, res := range r.Results {
+		rp := res.Replay
+		if rp == nil {
+			continue
+		}
+		_, err := fmt.Fprintf(w, "| %-22s | %.3f | %.1f | %.1f MB | %.1f MB | %s | %s | %s | %s |\n",
+			res.Format, rp.CPUCores, rp.AllocBytesPerSec/1024/1024,
+			float64(rp.MeanHeapGrowthBytes)/1024/1024, float64(rp.PeakHeapGrowthBytes)/1024/1024,
+			fmtNs(rp.Latency.P50), fmtNs(rp.Latency.P99), fmtNs(rp.Latency.Max), fmtNs(float64(rp.MaxLagNs)))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSoakMarkdown writes the --duration table and nothing otherwise. The
+// first and last columns are the samples taken before the first and after
+// the last pass of the soak.
+func writeSoakMarkdown(w io.Writer, r report) error {
+	if r.Soak == "" {
+		return nil
+	}
+	fmt.Fprintf(w, "\n## Soak (%s)\n\n", r.Soak)
+	fmt.Fprintln(w, "| Format | Passes | Live heap first → last | Heap trend | Goroutines first → last | FDs first → last | Growing | Left after Shutdown |")
+	fmt.Fprintln(w, "|--------|--------|------------------------|------------|-------------------------|------------------|---------|---------------------|")
+	for _, res := range r.Results {
+		sk := res.Soak
+		if sk == nil || len(sk.Samples) == 0 {
+			continue
+		}
+		first, last := sk.Samples[0], sk.Samples[len(sk.Samples)-1]
+		fds := "n/a"
+		if first.FDs >= 0 {
+			fds = fmt.Sprintf("%d → %d", first.FDs, last.FDs)
+		}
+		growth := strings.Join(sk.growth(), ", ")
+		if growth == "" {
+			growth = "-"
+		}
+		_, err := fmt.Fprintf(w, "| %-22s | %d | %.1f → %.1f MB | %+.1f MB/h | %d → %d | %s | %s | %s |\n",
+			res.Format, sk.Passes,
+			float64(first.HeapBytes)/1024/1024, float64(last.HeapBytes)/1024/1024,
+			sk.HeapBytesPerHour/1024/1024,
+			first.Goroutines, last.Goroutines, fds, growth, sk.leaked())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeIsolatedMarkdown writes the peak RSS of each format's child process
+// in --isolate mode and nothing otherwise. Every child loads the dataset and
+// starts the nop servers, so the differences between formats matter more
+// than the absolute numbers.
+func writeIsolatedMarkdown(w io.Writer, r report) error {
+	if !r.Isolated {
+		return nil
+	}
+	fmt.Fprintf(w, "\n## Peak RSS (one process per format)\n\n")
+	fmt.Fprintln(w, "| Format | Peak RSS |")
+	fmt.Fprintln(w, "|--------|----------|")
+	for _, res := range r.Results {
+		if _, err := fmt.Fprintf(w, "| %-22s | %.1f MB |\n", res.Format, float64(res.PeakRSSBytes)/1024/1024); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fmtNs(ns float64) string {
+	return time.Duration(ns).Round(time.Microsecond).String()
+}
+
+// writeCSV writes one row per format. Run-level fields are repeated on every
+// row so that each row stands on its own when loaded into a spreadsheet.
+// After the headline results and the run-level fields, columns are grouped
+// by what they describe; a group a run did not measure is left empty.
+func writeCSV(w io.Writer, r report) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{
+		"format", "total_bytes", "ratio", "serialize_time_ns", "alloc_bytes", "num_allocs",
+		"signal", "source", "files", "raw_bytes", "items", "iterations",
+		"timestamp", "go_version", "gomaxprocs", "host_fingerprint",
+		"concurrency", "queue", "faults", "retry", "tls", "isolated", "replay", "soak",
+		"codec", "cpu_time_ns", "raw_bytes_per_sec", "items_per_sec", "socket_bytes_in", "socket_bytes_out",
+		"time_min_ns", "time_p50_ns", "time_p90_ns", "time_p99_ns", "time_max_ns",
+		"time_stddev_ns", "time_ci95_low_ns", "time_ci95_high_ns", "time_cv",
+		"allocs_p50", "allocs_max", "alloc_bytes_p50", "alloc_bytes_max", "noisy",
+		"peak_rss_bytes", "peak_heap_bytes", "peak_stacks_bytes", "peak_runtime_bytes",
+		"gc_cycles", "gc_pause_ns", "gc_pause_max_ns",
+		"server_decode_ns", "server_decode_cpu_ns", "server_allocs", "server_alloc_bytes",
+		"verified", "lost_items", "lost_attributes", "lost_exemplars", "mismatched_requests",
+		"delivered_items_per_sec", "retries", "dropped_items",
+		"rejected_requests", "reset_connections", "withheld_acks",
+		"peak_heap_growth_bytes", "retained_heap_growth_bytes",
+		"replay_cpu_cores", "replay_alloc_bytes_per_sec",
+		"replay_mean_heap_growth_bytes", "replay_peak_heap_growth_bytes",
+		"replay_latency_p50_ns", "replay_latency_p99_ns", "replay_latency_max_ns", "replay_max_lag_ns",
+		"soak_passes", "soak_heap_growing", "soak_goroutines_growing", "soak_fds_growing",
+		"soak_heap_bytes_per_hour", "leaked_goroutines", "leaked_fds", "leaked_conns",
+	})
+	var replayMode string
+	if r.Replay != nil {
+		replayMode = r.Replay.Mode
+	}
+	for _, res := range r.Results {
+		row := []string{
+			res.Format,
+			strconv.FormatInt(res.TotalBytes, 10),
+			strconv.FormatFloat(res.Ratio, 'f', 4, 64),
+			strconv.FormatInt(res.SerializeTimeNs, 10),
+			strconv.FormatInt(res.AllocBytes, 10),
+			strconv.FormatInt(res.NumAllocs, 10),
+			string(r.Dataset.Signal),
+			r.Dataset.Source,
+			strconv.Itoa(r.Dataset.Files),
+			strconv.FormatInt(r.Dataset.RawBytes, 10),
+			strconv.Itoa(r.Dataset.Items),
+			strconv.Itoa(r.Iterations),
+			r.Timestamp.Format(time.RFC3339),
+			r.Environment.GoVersion,
+			strconv.Itoa(r.Environment.GOMAXPROCS),
+			r.Environment.HostFingerprint,
+			strconv.Itoa(r.Concurrency),
+			r.Queue,
+			r.Faults,
+			r.Retry,
+			strconv.FormatBool(r.TLS),
+			strconv.FormatBool(r.Isolated),
+			replayMode,
+			r.Soak,
+			res.Codec,
+			strconv.FormatInt(res.CPUTimeNs, 10),
+			fmtFloat(res.RawBytesPerSec),
+			fmtFloat(res.ItemsPerSec),
+			strconv.FormatInt(res.SocketBytesIn, 10),
+			strconv.FormatInt(res.SocketBytesOut, 10),
+			fmtFloat(res.SerializeTime.Min),
+			fmtFloat(res.SerializeTime.P50),
+			fmtFloat(res.SerializeTime.P90),
+			fmtFloat(res.SerializeTime.P99),
+			fmtFloat(res.SerializeTime.Max),
+			fmtFloat(res.SerializeTime.Stddev),
+			fmtFloat(res.SerializeTime.CI95Low),
+			fmtFloat(res.SerializeTime.CI95High),
+			strconv.FormatFloat(res.SerializeTime.CV, 'f', 4, 64),
+			fmtFloat(res.Allocs.P50),
+			fmtFloat(res.Allocs.Max),
+			fmtFloat(res.AllocBytesDist.P50),
+			fmtFloat(res.AllocBytesDist.Max),
+			strconv.FormatBool(res.Noisy),
+			strconv.FormatInt(res.PeakRSSBytes, 10),
+			strconv.FormatInt(res.Memory.PeakHeapBytes, 10),
+			strconv.FormatInt(res.Memory.PeakStacksBytes, 10),
+			strconv.FormatInt(res.Memory.PeakRuntimeBytes, 10),
+			strconv.FormatInt(res.Memory.GCCycles, 10),
+			strconv.FormatInt(res.Memory.GCPauseNs, 10),
+			strconv.FormatInt(res.Memory.GCPauseMaxNs, 10),
+		}
+		if d := res.ServerDecode; d != nil {
+			row = append(row,
+				strconv.FormatInt(d.DecodeTimeNs, 10),
+				strconv.FormatInt(d.DecodeCPUNs, 10),
+				strconv.FormatInt(d.Allocs, 10),
+				strconv.FormatInt(d.AllocBytes, 10),
+			)
+		} else {
+			row = append(row, "", "", "", "")
+		}
+		if v := res.Verify; v != nil {
+			lost := v.lost()
+			row = append(row,
+				strconv.FormatBool(v.ok()),
+				strconv.FormatInt(lost.Items, 10),
+				strconv.FormatInt(lost.Attributes, 10),
+				strconv.FormatInt(lost.Exemplars, 10),
+				strconv.Itoa(v.Mismatched),
+			)
+		} else {
+			row = append(row, "", "", "", "", "")
+		}
+		if d := res.Delivery; d != nil {
+			row = append(row,
+				fmtFloat(d.DeliveredItemsPerSec),
+				strconv.FormatFloat(d.Retries, 'f', -1, 64),
+				strconv.FormatFloat(d.DroppedItems, 'f', -1, 64),
+				strconv.FormatFloat(d.RejectedRequests, 'f', -1, 64),
+				strconv.FormatFloat(d.ResetConnections, 'f', -1, 64),
+				strconv.FormatFloat(d.WithheldAcks, 'f', -1, 64),
+				strconv.FormatInt(d.PeakHeapGrowthBytes, 10),
+				strconv.FormatInt(d.RetainedHeapGrowthBytes, 10),
+			)
+		} else {
+			row = append(row, "", "", "", "", "", "", "", "")
+		}
+		if rp := res.Replay; rp != nil {
+			row = append(row,
+				strconv.FormatFloat(rp.CPUCores, 'f', 3, 64),
+				fmtFloat(rp.AllocBytesPerSec),
+				strconv.FormatInt(rp.MeanHeapGrowthBytes, 10),
+				strconv.FormatInt(rp.PeakHeapGrowthBytes, 10),
+				fmtFloat(rp.Latency.P50),
+				fmtFloat(rp.Latency.P99),
+				fmtFloat(rp.Latency.Max),
+				strconv.FormatInt(rp.MaxLagNs, 10),
+			)
+		} else {
+			row = append(row, "", "", "", "", "", "", "", "")
+		}
+		if sk := res.Soak; sk != nil {
+			row = append(row,
+				strconv.Itoa(sk.Passes),
+				strconv.FormatBool(sk.HeapGrowing),
+				strconv.FormatBool(sk.GoroutinesGrowing),
+				strconv.FormatBool(sk.FDsGrowing),
+				fmtFloat(sk.HeapBytesPerHour),
+				strconv.Itoa(sk.LeakedGoroutines),
+				strconv.Itoa(sk.LeakedFDs),
+				strconv.FormatInt(sk.LeakedConns, 10),
+			)
+		} else {
+			row = append(row, "", "", "", "", "", "", "", "")
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func fmtFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', 0, 64)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+)
+
+func testReport() report {
+	ds := datasetSummary{Source: "test", Signal: signalMetrics, Files: 2, RawBytes: 1000, Items: 10}
+	return newReport(ds, 3, 0.1, []formatResult{
+		{name: "A", totalBytes: 500, serializeTime: time.Millisecond, allocBytes: 2048, numAllocs: 7},
+		{name: "B", totalBytes: 0, serializeTime: 2 * time.Millisecond},
+	})
+}
+
+func TestWriteReportJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeReport(&buf, testReport(), "json"); err != nil {
+		t.Fatal(err)
+	}
+
+	var got report
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Results) != 2 || got.Results[0].Ratio != 2 || got.Results[1].Ratio != 0 {
+		t.Errorf("unexpected results: %+v", got.Results)
+	}
+	if got.Dataset.Items != 10 || got.Iterations != 3 || got.Environment.GoVersion == "" {
+		t.Errorf("unexpected run metadata: %+v", got)
+	}
+}
+
+func TestWriteReportCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeReport(&buf, testReport(), "csv"); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want header + 2", len(rows))
+	}
+	for _, row := range rows {
+		if len(row) != len(rows[0]) {
+			t.Errorf("row has %d columns, header has %d", len(row), len(rows[0]))
+		}
+	}
+	if rows[1][0] != "A" || rows[1][3] != "1000000" {
+		t.Errorf("unexpected first row: %v", rows[1])
+	}
+	// Related columns stay together.
+	decode := slices.Index(rows[0], "server_decode_ns")
+	if decode < 0 || rows[0][decode+1] != "server_decode_cpu_ns" {
+		t.Errorf("server_decode_cpu_ns does not follow server_decode_ns in %v", rows[0])
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// peakRSS is not implemented on this platform and always returns 0.
+func peakRSS(*os.ProcessState) int64 { return 0 }
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/configcompression"
+	"go.opentelemetry.io/collector/confmap"
+	"go.opentelemetry.io/collector/confmap/xconfmap"
+	"go.opentelemetry.io/collector/exporter"
+	"go.opentelemetry.io/collector/exporter/otlpexporter"
+	"go.opentelemetry.io/collector/exporter/otlphttpexporter"
+
+	"github.com/open-telemetry/opentelemetry-collector-contrib/exporter/otelarrowexporter"
+	"github.com/open-telemetry/opentelemetry-collector-contrib/exporter/stefexporter"
+)
+
+// scenario is a --scenario file: named exporter configurations that replace
+// the built-in format matrix.
+type scenario struct {
+	Formats []scenarioFormat `mapstructure:"formats"`
+}
+
+// scenarioFormat is one benchmarked format. Config uses the exporter's
+// collector configuration syntax and is merged over the factory defaults.
+type scenarioFormat struct {
+	Name     string         `mapstructure:"name"`
+	Exporter string         `mapstructure:"exporter"`
+	Config   map[string]any `mapstructure:"config"`
+}
+
+// scenarioExporter ties an exporter type to its factory and nop server.
+type scenarioExporter struct {
+	factory exporter.Factory
+	// target returns the config keys that point the exporter at its nop
+	// server, and the server's stats.
+	target func(nopServers) (map[string]any, serverStats)
+	// regroups is passed on to benchFormat for --verify.
+	regroups bool
+}
+
+func grpcTarget(endpoint string, t *localTLS) map[string]any {
+	return map[string]any{
+		"endpoint": endpoint,
+		"tls":      scenarioTLS(t),
+	}
+}
+
+// scenarioExporters lists the exporter types a scenario can use, by their
+// collector type names, including deprecated aliases.
+var scenarioExporters = func() map[string]scenarioExporter {
+	otlp := scenarioExporter{
+		factory: otlpexporter.NewFactory(),
+		target: func(s nopServers) (map[string]any, serverStats) {
+			return grpcTarget(s.grpc.Endpoint(), s.grpc.tls), s.grpc.serverStats
+		},
+	}
+	otlphttp := scenarioExporter{
+		factory: otlphttpexporter.NewFactory(),
+		target: func(s nopServers) (map[string]any, serverStats) {
+			return map[string]any{"endpoint": s.http.Endpoint(), "tls": scenarioTLS(s.http.tls)}, s.http.serverStats
+		},
+	}
+	return map[string]scenarioExporter{
+		"otlp_grpc": otlp,
+		"otlp":      otlp,
+		"otlp_http": otlphttp,
+		"otlphttp":  otlphttp,
+		"otelarrow": {
+			factory: otelarrowexporter.NewFactory(),
+			target: func(s nopServers) (map[string]any, serverStats) {
+				return grpcTarget(s.arrow.Endpoint(), s.arrow.tls), s.arrow.serverStats
+			},
+			regroups: true,
+		},
+		"stef": {
+			factory: stefexporter.NewFactory(),
+			target: func(s nopServers) (map[string]any, serverStats) {
+				return grpcTarget(s.stef.Endpoint(), s.stef.tls), s.stef.serverStats
+			},
+			regroups: true,
+		},
+	}
+}()
+
+func exporterTypeNames() []string {
+	names := make([]string, 0, len(scenarioExporters))
+	for name := range scenarioExporters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadScenario reads and checks a scenario file.
+func loadScenario(path string) (scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return scenario{}, err
+	}
+	retrieved, err := confmap.NewRetrievedFromYAML(data)
+	if err != nil {
+		return scenario{}, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	conf, err := retrieved.AsConf()
+	if err != nil {
+		return scenario{}, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	var sc scenario
+	if err := conf.Unmarshal(&sc); err != nil {
+		return scenario{}, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if len(sc.Formats) == 0 {
+		return scenario{}, fmt.Errorf("%s lists no formats", path)
+	}
+	seen := map[string]bool{}
+	for i, f := range sc.Formats {
+		if f.Name == "" {
+			return scenario{}, fmt.Errorf("%s: format %d has no name", path, i)
+		}
+		if seen[f.Name] {
+			return scenario{}, fmt.Errorf("%s: duplicate format name %q", path, f.Name)
+		}
+		seen[f.Name] = true
+		if _, ok := scenarioExporters[f.Exporter]; !ok {
+			return scenario{}, fmt.Errorf("%s: format %q: unknown exporter %q (want one of %v)",
+				path, f.Name, f.Exporter, exporterTypeNames())
+		}
+	}
+	return sc, nil
+}
+
+// scenarioFormats builds a benchFormat per scenario entry. Each config is
+// unmarshaled over the factory's CreateDefaultConfig and validated up front,
+// so a bad entry fails before any benchmark runs. Entries whose exporter
+// does not support sig are skipped with a note on stderr.
+func scenarioFormats(sc scenario, sig signal, srvs nopServers) ([]benchFormat, error) {
+	var formats []benchFormat
+	for _, sf := range supportedScenarioFormats(sc, sig) {
+		se := scenarioExporters[sf.Exporter]
+		target, stats := se.target(srvs)
+		conf := confmap.NewFromStringMap(sf.Config)
+		if err := conf.Merge(confmap.NewFromStringMap(target)); err != nil {
+			return nil, fmt.Errorf("format %q: %w", sf.Name, err)
+		}
+
+		cfg := se.factory.CreateDefaultConfig()
+		if err := conf.Unmarshal(cfg); err != nil {
+			return nil, fmt.Errorf("format %q: %w", sf.Name, err)
+		}
+		if err := xconfmap.Validate(cfg); err != nil {
+			return nil, fmt.Errorf("format %q: %w", sf.Name, err)
+		}
+
+		f := newExporterFormat(sf.Name, sig, se.factory, func(cfg component.Config) error {
+			return conf.Unmarshal(cfg)
+		}, stats)
+		f.codec = configuredCodec(cfg)
+		f.regroups = se.regroups || configuredBatching(cfg)
+		formats = append(formats, f)
+	}
+	if len(formats) == 0 {
+		return nil, errors.New("no scenario format supports " + string(sig))
+	}
+	return formats, nil
+}
+
+// scenarioFormatNames lists the names of the formats scenarioFormats would
+// build, without nop servers to point them at or validating their configs.
+func scenarioFormatNames(sc scenario, sig signal) ([]string, error) {
+	var names []string
+	for _, sf := range supportedScenarioFormats(sc, sig) {
+		names = append(names, sf.Name)
+	}
+	if len(names) == 0 {
+		return nil, errors.New("no scenario format supports " + string(sig))
+	}
+	return names, nil
+}
+
+// supportedScenarioFormats returns the scenario entries whose exporter
+// supports sig, noting the others on stderr.
+func supportedScenarioFormats(sc scenario, sig signal) []scenarioFormat {
+	var supported []scenarioFormat
+	for _, sf := range sc.Formats {
+		if !supportsSignal(scenarioExporters[sf.Exporter].factory, sig) {
+			fmt.Fprintf(os.Stderr, "skipping %s: %s exporter does not support %s\n", sf.Name, sf.Exporter, sig)
+			continue
+		}
+		supported = append(supported, sf)
+	}
+	return supported
+}
+
+// configuredCodec reads the compression settings back out of a config, so
+// that defaults the scenario did not spell out are reported too.
+func configuredCodec(cfg component.Config) codec {
+	out := confmap.New()
+	if err := out.Marshal(cfg); err != nil {
+		return codec{}
+	}
+	typ := out.Get("compression")
+	if typ == nil {
+		return codec{}
+	}
+	c := codec{typ: configcompression.Type(fmt.Sprint(typ))}
+	if !c.typ.IsCompressed() {
+		return codec{}
+	}
+	if level, err := strconv.Atoi(fmt.Sprint(out.Get("compression_params::level"))); err == nil {
+		c.level = configcompression.Level(level)
+	}
+	return c
+}
+
+// configuredBatching reports whether cfg enables sending_queue batching,
+// which merges requests.
+func configuredBatching(cfg component.Config) bool {
+	out := confmap.New()
+	if err := out.Marshal(cfg); err != nil {
+		return false
+	}
+	return out.Get("sending_queue::batch") != nil
+}
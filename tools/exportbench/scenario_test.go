@@ -0,0 +1,117 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testNopServers() nopServers {
+	return nopServers{grpc: testGRPCServer, http: testHTTPServer, arrow: testArrowServer, stef: testSTEFServer}
+}
+
+func TestDefaultScenario(t *testing.T) {
+	sc, err := loadScenario(filepath.Join("scenarios", "default.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The shipped scenario mirrors the built-in matrix.
+	codecs, err := parseCodecs(defaultCodecs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sig := range []signal{signalMetrics, signalLogs, signalProfiles} {
+		builtin := buildFormats(sig, codecs, testNopServers(), queueMode{})
+		formats, err := scenarioFormats(sc, sig, testNopServers())
+		if err != nil {
+			t.Fatalf("%s: %v", sig, err)
+		}
+		if len(formats) != len(builtin) {
+			t.Fatalf("%s: scenario has %d formats, built-in matrix has %d", sig, len(formats), len(builtin))
+		}
+		for i, f := range formats {
+			b := builtin[i]
+			if f.name != b.name || f.codec != b.codec || f.regroups != b.regroups {
+				t.Errorf("%s: format %d = %q (%s), want %q (%s)", sig, i, f.name, f.codec, b.name, b.codec)
+			}
+		}
+	}
+}
+
+func TestScenarioDefaultsCompression(t *testing.T) {
+	// An entry without compression reports the exporter's default codec.
+	sc := scenario{Formats: []scenarioFormat{{Name: "otlp", Exporter: "otlp_grpc"}}}
+	formats, err := scenarioFormats(sc, signalMetrics, testNopServers())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := formats[0].codec.String(); got != "gzip" {
+		t.Errorf("codec = %s, want the otlp_grpc default gzip", got)
+	}
+}
+
+func TestBatchingRegroups(t *testing.T) {
+	// Batched requests are merged, so --verify must match items.
+	sc := scenario{Formats: []scenarioFormat{
+		{Name: "plain", Exporter: "otlp_grpc"},
+		{Name: "batched", Exporter: "otlp_grpc", Config: map[string]any{
+			"sending_queue": map[string]any{"batch": map[string]any{}},
+		}},
+	}}
+	formats, err := scenarioFormats(sc, signalMetrics, testNopServers())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if formats[0].regroups || !formats[1].regroups {
+		t.Errorf("regroups = %v, %v, want false, true", formats[0].regroups, formats[1].regroups)
+	}
+
+	q, err := parseQueueMode("", "items:100", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codecs, err := parseCodecs("none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range buildFormats(signalMetrics, codecs, testNopServers(), q) {
+		if !f.regroups {
+			t.Errorf("%s: batched format does not regroup", f.name)
+		}
+	}
+}
+
+func TestLoadScenarioErrors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		yaml string
+		want string
+	}{
+		"no formats":     {"formats: []", "no formats"},
+		"unnamed":        {"formats: [{exporter: otlp_grpc}]", "no name"},
+		"duplicate name": {"formats: [{name: a, exporter: otlp_grpc}, {name: a, exporter: otlp_http}]", "duplicate"},
+		"unknown":        {"formats: [{name: a, exporter: kafka}]", "unknown exporter"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "scenario.yaml")
+			if err := os.WriteFile(path, []byte(tc.yaml), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := loadScenario(path)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("err = %v, want %q", err, tc.want)
+			}
+		})
+	}
+
+	// Unknown config keys fail when the formats are built.
+	sc := scenario{Formats: []scenarioFormat{{
+		Name:     "a",
+		Exporter: "otlp_http",
+		Config:   map[string]any{"compresion": "zstd"},
+	}}}
+	if _, err := scenarioFormats(sc, signalMetrics, testNopServers()); err == nil {
+		t.Error("scenarioFormats accepted a misspelled key")
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
@@ -10,13 +11,22 @@ import (
 	"os"
 	"sync/atomic"
 
+	arrowpb "github.com/open-telemetry/otel-arrow/go/api/experimental/arrow/v1"
+	"github.com/open-telemetry/otel-arrow/go/pkg/otel/arrow_record"
 	stefgrpc "github.com/splunk/stef/go/grpc"
 	"github.com/splunk/stef/go/grpc/stef_proto"
 	"github.com/splunk/stef/go/otel/otelstef"
+	stefmetrics "github.com/splunk/stef/go/pdata/metrics"
 	"github.com/splunk/stef/go/pkg"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.opentelemetry.io/collector/pdata/pprofile/pprofileotlp"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
 	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
 )
 
 // bytesCounter tracks cumulative wire bytes using atomic operations.
@@ -27,6 +37,114 @@ type bytesCounter struct {
 func (c *bytesCounter) Add(n int64)         { c.total.Add(n) }
 func (c *bytesCounter) ReadAndReset() int64 { return c.total.Swap(0) }
 
+// serverStats is what every nop server exposes to the benchmark loop.
+type serverStats struct {
+	Counter *bytesCounter
+	Socket  *socketCounter
+	Decode  *decodeMeter
+	Capture *captureSink
+	// Faults counts injected failures. It is nil unless the server
+	// injects faults.
+	Faults *faultCounter
+}
+
+func newServerStats() serverStats {
+	return serverStats{
+		Counter: &bytesCounter{},
+		Socket:  &socketCounter{},
+		Decode:  &decodeMeter{},
+		Capture: &captureSink{},
+	}
+}
+
+// nopServers are the local servers every format sends to.
+type nopServers struct {
+	grpc  *grpcServer
+	http  *httpServer
+	arrow *arrowServer
+	stef  *stefServer
+}
+
+// startNopServers starts one nop server of each kind with opts.
+func startNopServers(opts serverOptions) (nopServers, error) {
+	var s nopServers
+	var err error
+	if s.grpc, err = startGRPCServer(opts); err != nil {
+		return nopServers{}, fmt.Errorf("starting gRPC server: %w", err)
+	}
+	if s.http, err = startHTTPServer(opts); err != nil {
+		s.stop()
+		return nopServers{}, fmt.Errorf("starting HTTP server: %w", err)
+	}
+	if s.stef, err = startSTEFServer(opts); err != nil {
+		s.stop()
+		return nopServers{}, fmt.Errorf("starting STEF server: %w", err)
+	}
+	if s.arrow, err = startArrowServer(opts); err != nil {
+		s.stop()
+		return nopServers{}, fmt.Errorf("starting OTel Arrow server: %w", err)
+	}
+	return s, nil
+}
+
+// stop stops the servers that were started.
+func (s nopServers) stop() {
+	if s.grpc != nil {
+		s.grpc.Stop()
+	}
+	if s.http != nil {
+		s.http.Stop()
+	}
+	if s.stef != nil {
+		s.stef.Stop()
+	}
+	if s.arrow != nil {
+		s.arrow.Stop()
+	}
+}
+
+// serverOptions configures how the nop servers handle received requests.
+type serverOptions struct {
+	// decode makes the servers unmarshal every request into pdata, as a
+	// collector receiver would, and charge the cost to their Decode meter.
+	decode bool
+	// faults degrades the servers, for comparing retry and backpressure
+	// behavior.
+	faults faultConfig
+	// tls serves every server over TLS with a local certificate.
+	tls *localTLS
+	// addr is the address to listen on, a free localhost port if empty.
+	addr string
+	// capture, if set, replaces the server's own capture sink, so that
+	// several servers can feed one sink.
+	capture *captureSink
+}
+
+// listen opens a nop server's listener. Faults wrap the raw TCP connection,
+// socket counting wraps that, and TLS comes last, so that the socket counts
+// include TLS records. protos are offered through ALPN.
+func listen(opts serverOptions, protos ...string) (net.Listener, *faultInjector, serverStats, error) {
+	addr := opts.addr
+	if addr == "" {
+		addr = "localhost:0"
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, serverStats{}, fmt.Errorf("listen: %w", err)
+	}
+	fi, lis := newFaultInjector(opts.faults, lis)
+	stats := newServerStats()
+	if opts.capture != nil {
+		stats.Capture = opts.capture
+	}
+	stats.Faults = fi.faultCounter()
+	lis = &countingListener{Listener: lis, counter: stats.Socket}
+	if opts.tls != nil {
+		lis = tls.NewListener(lis, opts.tls.serverConfig(protos...))
+	}
+	return lis, fi, stats, nil
+}
+
 // --- gRPC nop server ---
 
 type nopMetricsGRPCServer struct {
@@ -37,6 +155,32 @@ func (s *nopMetricsGRPCServer) Export(_ context.Context, _ *colmetricspb.ExportM
 	return &colmetricspb.ExportMetricsServiceResponse{}, nil
 }
 
+type nopLogsGRPCServer struct {
+	collogspb.UnimplementedLogsServiceServer
+}
+
+func (s *nopLogsGRPCServer) Export(_ context.Context, _ *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
+type nopTracesGRPCServer struct {
+	coltracepb.UnimplementedTraceServiceServer
+}
+
+func (s *nopTracesGRPCServer) Export(_ context.Context, _ *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+// nopProfilesGRPCServer uses the pdata gRPC bindings because the generated
+// OTLP protos do not ship the development profiles service.
+type nopProfilesGRPCServer struct {
+	pprofileotlp.UnimplementedGRPCServer
+}
+
+func (s *nopProfilesGRPCServer) Export(_ context.Context, _ pprofileotlp.ExportRequest) (pprofileotlp.ExportResponse, error) {
+	return pprofileotlp.NewExportResponse(), nil
+}
+
 // grpcBytesHandler is a gRPC stats handler that tracks wire bytes received.
 type grpcBytesHandler struct {
 	counter *bytesCounter
@@ -56,27 +200,43 @@ func (h *grpcBytesHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) co
 func (h *grpcBytesHandler) HandleConn(_ context.Context, _ stats.ConnStats) {}
 
 type grpcServer struct {
-	server  *grpc.Server
-	lis     net.Listener
-	Counter *bytesCounter
+	server *grpc.Server
+	lis    net.Listener
+	tls    *localTLS
+	serverStats
 }
 
-func startGRPCServer() (*grpcServer, error) {
-	lis, err := net.Listen("tcp", "localhost:0")
+func startGRPCServer(opts serverOptions) (*grpcServer, error) {
+	lis, fi, stats, err := listen(opts, "h2")
 	if err != nil {
-		return nil, fmt.Errorf("listen: %w", err)
+		return nil, err
+	}
+	counter, meter, sink := stats.Counter, stats.Decode, stats.Capture
+	serverOpts := []grpc.ServerOption{grpc.StatsHandler(&grpcBytesHandler{counter: counter})}
+	serverOpts = append(serverOpts, fi.grpcOptions()...)
+	if opts.decode {
+		// No services are registered: every Export call falls through to
+		// the raw handler, which decodes under the meter.
+		serverOpts = append(serverOpts,
+			grpc.ForceServerCodec(rawCodec{}),
+			grpc.UnknownServiceHandler(decodingGRPCHandler(meter, sink)),
+		)
+	}
+	srv := grpc.NewServer(serverOpts...)
+	if !opts.decode {
+		colmetricspb.RegisterMetricsServiceServer(srv, &nopMetricsGRPCServer{})
+		collogspb.RegisterLogsServiceServer(srv, &nopLogsGRPCServer{})
+		coltracepb.RegisterTraceServiceServer(srv, &nopTracesGRPCServer{})
+		pprofileotlp.RegisterGRPCServer(srv, &nopProfilesGRPCServer{})
 	}
-
-	counter := &bytesCounter{}
-	srv := grpc.NewServer(grpc.StatsHandler(&grpcBytesHandler{counter: counter}))
-	colmetricspb.RegisterMetricsServiceServer(srv, &nopMetricsGRPCServer{})
 
 	go srv.Serve(lis)
 
 	return &grpcServer{
-		server:  srv,
-		lis:     lis,
-		Counter: counter,
+		server:      srv,
+		lis:         lis,
+		tls:         opts.tls,
+		serverStats: stats,
 	}, nil
 }
 
@@ -86,37 +246,75 @@ func (s *grpcServer) Stop()            { s.server.GracefulStop() }
 // --- HTTP nop server ---
 
 type httpServer struct {
-	server  *http.Server
-	lis     net.Listener
-	Counter *bytesCounter
+	server *http.Server
+	lis    net.Listener
+	tls    *localTLS
+	serverStats
 }
 
-func startHTTPServer() (*httpServer, error) {
-	lis, err := net.Listen("tcp", "localhost:0")
+func startHTTPServer(opts serverOptions) (*httpServer, error) {
+	lis, fi, stats, err := listen(opts, "h2", "http/1.1")
 	if err != nil {
-		return nil, fmt.Errorf("listen: %w", err)
+		return nil, err
 	}
+	counter, meter, sink := stats.Counter, stats.Decode, stats.Capture
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if !opts.decode {
+			n, _ := io.Copy(io.Discard, r.Body)
+			counter.Add(n)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
 
-	counter := &bytesCounter{}
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		n, _ := io.Copy(io.Discard, r.Body)
-		counter.Add(n)
+		body, err := io.ReadAll(r.Body)
+		counter.Add(int64(len(body)))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sig, _ := signalFromPath(r.URL.Path)
+		json := r.Header.Get("Content-Type") == "application/json"
+		var p payload
+		err = meter.observe(func() error {
+			raw, err := decompressBody(r.Header.Get("Content-Encoding"), body)
+			if err != nil {
+				return err
+			}
+			p, err = decodeRequest(sig, raw, json)
+			return err
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sink.capture(p)
 		w.WriteHeader(http.StatusOK)
-	})
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/metrics", handler)
+	mux.HandleFunc("/v1/logs", handler)
+	mux.HandleFunc("/v1/traces", handler)
+	mux.HandleFunc("/v1development/profiles", handler)
 
-	srv := &http.Server{Handler: mux}
+	srv := &http.Server{Handler: fi.httpHandler(mux)}
 	go srv.Serve(lis)
 
 	return &httpServer{
-		server:  srv,
-		lis:     lis,
-		Counter: counter,
+		server:      srv,
+		lis:         lis,
+		tls:         opts.tls,
+		serverStats: stats,
 	}, nil
 }
 
-func (s *httpServer) Endpoint() string { return "http://" + s.lis.Addr().String() }
-func (s *httpServer) Stop()            { s.server.Shutdown(context.Background()) }
+func (s *httpServer) Endpoint() string {
+	if s.tls != nil {
+		return "https://" + s.lis.Addr().String()
+	}
+	return "http://" + s.lis.Addr().String()
+}
+
+func (s *httpServer) Stop() { s.server.Shutdown(context.Background()) }
 
 // --- STEF nop server ---
 // Models the stefexporter test server: accepts STEF streams, reads records, sends ACKs.
@@ -124,16 +322,16 @@ func (s *httpServer) Stop()            { s.server.Shutdown(context.Background())
 type stefServer struct {
 	grpcSrv *grpc.Server
 	lis     net.Listener
-	Counter *bytesCounter
+	tls     *localTLS
+	serverStats
 }
 
-func startSTEFServer() (*stefServer, error) {
-	lis, err := net.Listen("tcp", "localhost:0")
+func startSTEFServer(opts serverOptions) (*stefServer, error) {
+	lis, fi, stats, err := listen(opts, "h2")
 	if err != nil {
-		return nil, fmt.Errorf("listen: %w", err)
+		return nil, err
 	}
-
-	counter := &bytesCounter{}
+	counter, meter, sink := stats.Counter, stats.Decode, stats.Capture
 	grpcSrv := grpc.NewServer(grpc.StatsHandler(&grpcBytesHandler{counter: counter}))
 
 	schema, err := otelstef.MetricsWireSchema()
@@ -145,7 +343,13 @@ func startSTEFServer() (*stefServer, error) {
 		ServerSchema: &schema,
 		Callbacks: stefgrpc.Callbacks{
 			OnStream: func(reader stefgrpc.GrpcReader, stream stefgrpc.STEFStream) error {
-				mr, err := otelstef.NewMetricsReader(reader)
+				acks := newSTEFAcker(fi, stream.SendDataResponse)
+				defer acks.close()
+				src := fi.stefReader(reader)
+				if opts.decode {
+					return decodeSTEFStream(newPausingChunkReader(src, meter), acks, sink)
+				}
+				mr, err := otelstef.NewMetricsReader(src)
 				if err != nil {
 					return err
 				}
@@ -153,9 +357,7 @@ func startSTEFServer() (*stefServer, error) {
 					if err := mr.Read(pkg.ReadOptions{}); err != nil {
 						return err
 					}
-					if err := stream.SendDataResponse(&stef_proto.STEFDataResponse{
-						AckRecordId: mr.RecordCount(),
-					}); err != nil {
+					if err := acks.ack(mr.RecordCount()); err != nil {
 						return err
 					}
 				}
@@ -171,11 +373,169 @@ func startSTEFServer() (*stefServer, error) {
 	}()
 
 	return &stefServer{
-		grpcSrv: grpcSrv,
-		lis:     lis,
-		Counter: counter,
+		grpcSrv:     grpcSrv,
+		lis:         lis,
+		tls:         opts.tls,
+		serverStats: stats,
 	}, nil
 }
 
+// decodeSTEFStream converts a STEF metrics stream back into pdata a frame at
+// a time, as stefreceiver does. It reads through a pausing reader, so that
+// only decoding and conversion, not waiting for chunks or sending ACKs, is
+// charged to the meter.
+func decodeSTEFStream(reader *pausingChunkReader, acks *stefAcker, sink *captureSink) error {
+	defer reader.close()
+	mr, err := otelstef.NewMetricsReader(reader)
+	if err != nil {
+		return err
+	}
+	var converter stefmetrics.STEFToOTLPUnsorted
+	for {
+		md, err := converter.ConvertTillEndOfFrame(mr)
+		if err != nil {
+			return err
+		}
+		err = reader.frameDone(func() error {
+			sink.capture(payload{signal: signalMetrics, metrics: pmetricotlp.NewExportRequestFromMetrics(md)})
+			return acks.ack(mr.RecordCount())
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
 func (s *stefServer) Endpoint() string { return s.lis.Addr().String() }
 func (s *stefServer) Stop()            { s.grpcSrv.GracefulStop() }
+
+// --- OTel Arrow nop server ---
+// Models the otelarrowreceiver: accepts Arrow streams and acknowledges every batch.
+
+type arrowServer struct {
+	grpcSrv *grpc.Server
+	lis     net.Listener
+	tls     *localTLS
+	opts    serverOptions
+	faults  *faultInjector
+	serverStats
+}
+
+type nopArrowMetricsServer struct {
+	arrowpb.UnimplementedArrowMetricsServiceServer
+	srv *arrowServer
+}
+
+func (s *nopArrowMetricsServer) ArrowMetrics(stream arrowpb.ArrowMetricsService_ArrowMetricsServer) error {
+	return s.srv.serve(stream, signalMetrics)
+}
+
+type nopArrowLogsServer struct {
+	arrowpb.UnimplementedArrowLogsServiceServer
+	srv *arrowServer
+}
+
+func (s *nopArrowLogsServer) ArrowLogs(stream arrowpb.ArrowLogsService_ArrowLogsServer) error {
+	return s.srv.serve(stream, signalLogs)
+}
+
+type nopArrowTracesServer struct {
+	arrowpb.UnimplementedArrowTracesServiceServer
+	srv *arrowServer
+}
+
+func (s *nopArrowTracesServer) ArrowTraces(stream arrowpb.ArrowTracesService_ArrowTracesServer) error {
+	return s.srv.serve(stream, signalTraces)
+}
+
+func startArrowServer(opts serverOptions) (*arrowServer, error) {
+	lis, fi, stats, err := listen(opts, "h2")
+	if err != nil {
+		return nil, err
+	}
+	grpcSrv := grpc.NewServer(grpc.StatsHandler(&grpcBytesHandler{counter: stats.Counter}))
+	srv := &arrowServer{
+		grpcSrv:     grpcSrv,
+		lis:         lis,
+		tls:         opts.tls,
+		opts:        opts,
+		faults:      fi,
+		serverStats: stats,
+	}
+	arrowpb.RegisterArrowMetricsServiceServer(grpcSrv, &nopArrowMetricsServer{srv: srv})
+	arrowpb.RegisterArrowLogsServiceServer(grpcSrv, &nopArrowLogsServer{srv: srv})
+	arrowpb.RegisterArrowTracesServiceServer(grpcSrv, &nopArrowTracesServer{srv: srv})
+
+	go func() {
+		if err := grpcSrv.Serve(lis); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			fmt.Fprintf(os.Stderr, "OTel Arrow server error: %v\n", err)
+		}
+	}()
+
+	return srv, nil
+}
+
+// arrowStream is the part of the generated Arrow stream servers that serve
+// needs; the three signals share it.
+type arrowStream interface {
+	Context() context.Context
+	Recv() (*arrowpb.BatchArrowRecords, error)
+	Send(*arrowpb.BatchStatus) error
+}
+
+func (s *arrowServer) serve(stream arrowStream, sig signal) error {
+	// Arrow streams are stateful: dictionaries and schemas sent earlier in
+	// the stream are referenced by later batches, so each stream gets its
+	// own consumer.
+	var consumer *arrow_record.Consumer
+	if s.opts.decode {
+		consumer = arrow_record.NewConsumer()
+		defer consumer.Close()
+	}
+	for {
+		batch, err := stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) || status.Code(err) == codes.Canceled {
+				return nil
+			}
+			return err
+		}
+		switch s.faults.apply(peerAddr(stream.Context())) {
+		case faultReset:
+			return status.Error(codes.Unavailable, "injected connection reset")
+		case faultReject:
+			// A rejected batch gets a retryable status, as
+			// otelarrowreceiver sends under memory pressure.
+			if err := stream.Send(&arrowpb.BatchStatus{
+				BatchId:       batch.BatchId,
+				StatusCode:    arrowpb.StatusCode_UNAVAILABLE,
+				StatusMessage: "injected fault",
+			}); err != nil {
+				return err
+			}
+			continue
+		}
+		if consumer != nil {
+			var decoded []payload
+			err := s.Decode.observe(func() (err error) {
+				decoded, err = decodeArrowBatch(consumer, sig, batch)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			for _, p := range decoded {
+				s.Capture.capture(p)
+			}
+		}
+		if err := stream.Send(&arrowpb.BatchStatus{
+			BatchId:    batch.BatchId,
+			StatusCode: arrowpb.StatusCode_OK,
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *arrowServer) Endpoint() string { return s.lis.Addr().String() }
+func (s *arrowServer) Stop()            { s.grpcSrv.GracefulStop() }
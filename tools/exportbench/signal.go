@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/exporter"
+	"go.opentelemetry.io/collector/exporter/xexporter"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.opentelemetry.io/collector/pdata/pprofile/pprofileotlp"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+)
+
+// signal identifies the OTLP signal type carried by a payload directory.
+type signal string
+
+const (
+	signalAuto     signal = "auto"
+	signalMetrics  signal = "metrics"
+	signalLogs     signal = "logs"
+	signalTraces   signal = "traces"
+	signalProfiles signal = "profiles"
+)
+
+// detectOrder is the order in which detectSignal tries each signal.
+var detectOrder = []signal{signalMetrics, signalLogs, signalTraces, signalProfiles}
+
+func parseSignal(s string) (signal, error) {
+	switch sig := signal(s); sig {
+	case signalAuto, signalMetrics, signalLogs, signalTraces, signalProfiles:
+		return sig, nil
+	default:
+		return "", fmt.Errorf("unknown signal %q (want auto, metrics, logs, traces or profiles)", s)
+	}
+}
+
+// itemName is the human-readable unit counted by payload.itemCount.
+func (s signal) itemName() string {
+	switch s {
+	case signalLogs:
+		return "log records"
+	case signalTraces:
+		return "spans"
+	case signalProfiles:
+		return "profile samples"
+	default:
+		return "data points"
+	}
+}
+
+// detectSignal guesses which ExportXServiceRequest a raw protobuf holds.
+// The OTLP messages share field numbers at the top levels, so a payload can
+// unmarshal as more than one signal, with the fields that do not fit its
+// shape skipped as unknown. Of the signals it unmarshals as with at least
+// one item, the one that keeps the most of the payload when re-marshaled
+// wins, and ties go to detectOrder. Encodings that are valid but not
+// canonical, such as unknown fields or another field order, shrink every
+// candidate alike.
+func detectSignal(data []byte) (signal, error) {
+	var best signal
+	bestSize := -1
+	for _, sig := range detectOrder {
+		p, err := unmarshalPayload(sig, "", data)
+		if err != nil || p.itemCount() == 0 {
+			continue
+		}
+		out, err := p.marshalProto()
+		if err == nil && len(out) > bestSize {
+			best, bestSize = sig, len(out)
+		}
+	}
+	if best == "" {
+		return "", errors.New("cannot detect signal type, set --signal explicitly")
+	}
+	return best, nil
+}
+
+// unmarshalPayload decodes a raw ExportXServiceRequest for the given signal.
+func unmarshalPayload(sig signal, filename string, data []byte) (payload, error) {
+	p := payload{filename: filename, raw: data, signal: sig}
+	var err error
+	switch sig {
+	case signalMetrics:
+		p.metrics = pmetricotlp.NewExportRequest()
+		err = p.metrics.UnmarshalProto(data)
+	case signalLogs:
+		p.logs = plogotlp.NewExportRequest()
+		err = p.logs.UnmarshalProto(data)
+	case signalTraces:
+		p.traces = ptraceotlp.NewExportRequest()
+		err = p.traces.UnmarshalProto(data)
+	case signalProfiles:
+		p.profiles = pprofileotlp.NewExportRequest()
+		err = p.profiles.UnmarshalProto(data)
+	default:
+		err = fmt.Errorf("unsupported signal %q", sig)
+	}
+	if err != nil {
+		return payload{}, err
+	}
+	return p, nil
+}
+
+func (p payload) marshalProto() ([]byte, error) {
+	switch p.signal {
+	case signalLogs:
+		return p.logs.MarshalProto()
+	case signalTraces:
+		return p.traces.MarshalProto()
+	case signalProfiles:
+		return p.profiles.MarshalProto()
+	default:
+		return p.metrics.MarshalProto()
+	}
+}
+
+// itemCount returns the number of data points, log records, spans or profile
+// samples in the payload.
+func (p payload) itemCount() int {
+	switch p.signal {
+	case signalLogs:
+		return p.logs.Logs().LogRecordCount()
+	case signalTraces:
+		return p.traces.Traces().SpanCount()
+	case signalProfiles:
+		return p.profiles.Profiles().SampleCount()
+	default:
+		return p.metrics.Metrics().DataPointCount()
+	}
+}
+
+// payloadExporter wraps a signal-specific exporter so that formats can drive
+// any signal through the same export loop.
+type payloadExporter struct {
+	component.Component
+	consume func(context.Context, payload) error
+}
+
+func createPayloadExporter(ctx context.Context, factory exporter.Factory, set exporter.Settings, cfg component.Config, sig signal) (*payloadExporter, error) {
+	switch sig {
+	case signalMetrics:
+		exp, err := factory.CreateMetrics(ctx, set, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return &payloadExporter{
+			Component: exp,
+			consume: func(ctx context.Context, p payload) error {
+				return exp.ConsumeMetrics(ctx, p.metrics.Metrics())
+			},
+		}, nil
+	case signalLogs:
+		exp, err := factory.CreateLogs(ctx, set, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return &payloadExporter{
+			Component: exp,
+			consume: func(ctx context.Context, p payload) error {
+				return exp.ConsumeLogs(ctx, p.logs.Logs())
+			},
+		}, nil
+	case signalTraces:
+		exp, err := factory.CreateTraces(ctx, set, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return &payloadExporter{
+			Component: exp,
+			consume: func(ctx context.Context, p payload) error {
+				return exp.ConsumeTraces(ctx, p.traces.Traces())
+			},
+		}, nil
+	case signalProfiles:
+		xf, ok := factory.(xexporter.Factory)
+		if !ok {
+			return nil, fmt.Errorf("%s exporter does not support profiles", factory.Type())
+		}
+		exp, err := xf.CreateProfiles(ctx, set, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return &payloadExporter{
+			Component: exp,
+			consume: func(ctx context.Context, p payload) error {
+				return exp.ConsumeProfiles(ctx, p.profiles.Profiles())
+			},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported signal %q", sig)
+	}
+}
+
+// supportsSignal reports whether factory has a pipeline for sig.
+func supportsSignal(factory exporter.Factory, sig signal) bool {
+	switch sig {
+	case signalMetrics:
+		return factory.MetricsStability() != component.StabilityLevelUndefined
+	case signalLogs:
+		return factory.LogsStability() != component.StabilityLevelUndefined
+	case signalTraces:
+		return factory.TracesStability() != component.StabilityLevelUndefined
+	case signalProfiles:
+		xf, ok := factory.(xexporter.Factory)
+		return ok && xf.ProfilesStability() != component.StabilityLevelUndefined
+	default:
+		return false
+	}
+}
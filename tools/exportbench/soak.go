@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+// soakSample is the state of the process at one point of a --duration
+// soak. The heap is sampled after a garbage collection, so it is the live
+// heap rather than whatever the collector has not swept yet.
+type soakSample struct {
+	elapsed    time.Duration
+	heap       int64
+	goroutines int
+	// fds is -1 where open file descriptors cannot be counted.
+	fds int
+}
+
+func takeSoakSample(elapsed time.Duration) soakSample {
+	runtime.GC()
+	return soakSample{
+		elapsed:    elapsed,
+		heap:       readHeapObjects(),
+		goroutines: runtime.NumGoroutine(),
+		fds:        openFDs(),
+	}
+}
+
+// soakInterval spreads about 60 samples over a soak.
+func soakInterval(d time.Duration) time.Duration {
+	return max(d/60, 100*time.Millisecond)
+}
+
+// soakResult is how a format behaved over a --duration soak and after its
+// exporter was shut down.
+type soakResult struct {
+	elapsed time.Duration
+	passes  int
+	samples []soakSample
+	leaked  leakCount
+}
+
+// runSoak exports the dataset over and over for d, keeping one exporter,
+// and samples the process between passes at least every interval. The
+// first sample is taken before the first pass and the last after the last.
+func runSoak(export func([]payload) error, payloads []payload, d, interval time.Duration) (soakResult, error) {
+	var res soakResult
+	start := time.Now()
+	res.samples = append(res.samples, takeSoakSample(0))
+	next := interval
+	for {
+		if err := export(payloads); err != nil {
+			return soakResult{}, fmt.Errorf("pass %d: %w", res.passes+1, err)
+		}
+		res.passes++
+		elapsed := time.Since(start)
+		done := elapsed >= d
+		if done || elapsed >= next {
+			res.samples = append(res.samples, takeSoakSample(elapsed))
+			for next <= elapsed {
+				next += interval
+			}
+		}
+		if done {
+			break
+		}
+	}
+	res.elapsed = time.Since(start)
+	return res, nil
+}
+
+// leakCount is what is left over after a format's exporter was shut down,
+// compared to before it was created.
+type leakCount struct {
+	goroutines int
+	fds        int
+	conns      int64
+}
+
+func (l leakCount) any() bool { return l.goroutines > 0 || l.fds > 0 || l.conns > 0 }
+
+func (l leakCount) String() string {
+	var parts []string
+	if l.goroutines > 0 {
+		parts = append(parts, fmt.Sprintf("%d goroutines", l.goroutines))
+	}
+	if l.fds > 0 {
+		parts = append(parts, fmt.Sprintf("%d fds", l.fds))
+	}
+	if l.conns > 0 {
+		parts = append(parts, fmt.Sprintf("%d server connections", l.conns))
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// processBaseline is what the process holds before a format's exporter is
+// created.
+type processBaseline struct {
+	goroutines int
+	fds        int
+	conns      int64
+}
+
+func takeBaseline(f benchFormat) processBaseline {
+	return processBaseline{goroutines: runtime.NumGoroutine(), fds: openFDs(), conns: f.openConns()}
+}
+
+// leakGrace is how long checkLeaks waits for goroutines and connections to
+// wind down after Shutdown returns.
+const leakGrace = 5 * time.Second
+
+// checkLeaks compares the process with the baseline once the exporter is
+// shut down. Shutdown may return before every connection is closed, so it
+// polls for up to grace before reporting what is left.
+func checkLeaks(f benchFormat, base processBaseline, grace time.Duration) leakCount {
+	deadline := time.Now().Add(grace)
+	for {
+		l := leakCount{
+			goroutines: max(runtime.NumGoroutine()-base.goroutines, 0),
+			conns:      max(f.openConns()-base.conns, 0),
+		}
+		if base.fds >= 0 {
+			l.fds = max(openFDs()-base.fds, 0)
+		}
+		if !l.any() || time.Now().After(deadline) {
+			return l
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// growing reports whether a series rose steadily: every sample in its last
+// third is more than slack above every sample in its first third. Short
+// series are never flagged.
+func growing(xs []float64, slack float64) bool {
+	if len(xs) < 6 {
+		return false
+	}
+	n := len(xs) / 3
+	return slices.Min(xs[len(xs)-n:]) > slices.Max(xs[:n])+slack
+}
+
+// slopePerHour fits a least-squares line through the samples and returns
+// its slope per hour of soak.
+func slopePerHour(ts, xs []float64) float64 {
+	mt, mx := mean(ts), mean(xs)
+	var num, den float64
+	for i := range ts {
+		num += (ts[i] - mt) * (xs[i] - mx)
+		den += (ts[i] - mt) * (ts[i] - mt)
+	}
+	if den == 0 {
+		return 0
+	}
+	return num / den * time.Hour.Seconds()
+}
+
+// heapGrowthSlack keeps allocator and runtime noise in the live heap from
+// being flagged as a leak.
+const heapGrowthSlack = 1 << 20
+
+// soakRecord is the serialized form of a soakResult.
+type soakRecord struct {
+	ElapsedNs         int64              `json:"elapsed_ns"`
+	Passes            int                `json:"passes"`
+	HeapGrowing       bool               `json:"heap_growing"`
+	GoroutinesGrowing bool               `json:"goroutines_growing"`
+	FDsGrowing        bool               `json:"fds_growing"`
+	HeapBytesPerHour  float64            `json:"heap_bytes_per_hour"`
+	LeakedGoroutines  int                `json:"leaked_goroutines"`
+	LeakedFDs         int                `json:"leaked_fds"`
+	LeakedConns       int64              `json:"leaked_conns"`
+	Samples           []soakSampleRecord `json:"samples"`
+}
+
+type soakSampleRecord struct {
+	ElapsedNs  int64 `json:"elapsed_ns"`
+	HeapBytes  int64 `json:"heap_bytes"`
+	Goroutines int   `json:"goroutines"`
+	FDs        int   `json:"fds"`
+}
+
+func newSoakRecord(r soakResult) *soakRecord {
+	rec := &soakRecord{
+		ElapsedNs:        r.elapsed.Nanoseconds(),
+		Passes:           r.passes,
+		LeakedGoroutines: r.leaked.goroutines,
+		LeakedFDs:        r.leaked.fds,
+		LeakedConns:      r.leaked.conns,
+		Samples:          []soakSampleRecord{},
+	}
+	var ts, heap, goroutines, fds []float64
+	for _, s := range r.samples {
+		rec.Samples = append(rec.Samples, soakSampleRecord{
+			ElapsedNs:  s.elapsed.Nanoseconds(),
+			HeapBytes:  s.heap,
+			Goroutines: s.goroutines,
+			FDs:        s.fds,
+		})
+		ts = append(ts, s.elapsed.Seconds())
+		heap = append(heap, float64(s.heap))
+		goroutines = append(goroutines, float64(s.goroutines))
+		fds = append(fds, float64(s.fds))
+	}
+	rec.HeapGrowing = growing(heap, heapGrowthSlack)
+	rec.GoroutinesGrowing = growing(goroutines, 0)
+	rec.FDsGrowing = growing(fds, 0)
+	rec.HeapBytesPerHour = slopePerHour(ts, heap)
+	return rec
+}
+
+// growth lists the series a soak flagged as growing.
+func (r *soakRecord) growth() []string {
+	var flagged []string
+	if r.HeapGrowing {
+		flagged = append(flagged, "heap")
+	}
+	if r.GoroutinesGrowing {
+		flagged = append(flagged, "goroutines")
+	}
+	if r.FDsGrowing {
+		flagged = append(flagged, "fds")
+	}
+	return flagged
+}
+
+func (r *soakRecord) leaked() leakCount {
+	return leakCount{goroutines: r.LeakedGoroutines, fds: r.LeakedFDs, conns: r.LeakedConns}
+}
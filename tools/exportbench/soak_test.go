@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGrowing(t *testing.T) {
+	for _, tt := range []struct {
+		xs    []float64
+		slack float64
+		want  bool
+	}{
+		{xs: []float64{10, 11, 12, 13, 14, 15}, want: true},
+		{xs: []float64{10, 11, 12, 13, 14, 15}, slack: 5, want: false},
+		// A sawtooth that returns to its floor is not a leak.
+		{xs: []float64{10, 14, 10, 14, 10, 14, 10, 14, 10}, want: false},
+		{xs: []float64{10, 12, 11, 13, 12, 14, 13, 15, 14}, want: true},
+		{xs: []float64{10, 20, 30}, want: false},
+	} {
+		if got := growing(tt.xs, tt.slack); got != tt.want {
+			t.Errorf("growing(%v, %v) = %v, want %v", tt.xs, tt.slack, got, tt.want)
+		}
+	}
+
+	ts := []float64{0, 1800, 3600}
+	if got := slopePerHour(ts, []float64{100, 150, 200}); got != 100 {
+		t.Errorf("slope = %v per hour, want 100", got)
+	}
+}
+
+func TestRunSoak(t *testing.T) {
+	f := newGRPCFormat("soak", testSignal, testGRPCServer, codec{}, queueMode{})
+	base := takeBaseline(f)
+	if err := f.setup(); err != nil {
+		t.Fatal(err)
+	}
+	res, err := runSoak(f.export, testPayloads, 300*time.Millisecond, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.cleanup()
+	res.leaked = checkLeaks(f, base, leakGrace)
+
+	if res.passes == 0 || len(res.samples) < 2 || res.elapsed < 300*time.Millisecond {
+		t.Errorf("soak ran %d passes with %d samples in %s", res.passes, len(res.samples), res.elapsed)
+	}
+	if last := res.samples[len(res.samples)-1]; last.elapsed < 300*time.Millisecond {
+		t.Errorf("last sample at %s, before the end of the soak", last.elapsed)
+	}
+	// The gRPC exporter closes its connection on Shutdown.
+	if res.leaked.conns != 0 {
+		t.Errorf("%d server connections left open", res.leaked.conns)
+	}
+	rec := newSoakRecord(res)
+	if rec.Passes != res.passes || len(rec.Samples) != len(res.samples) {
+		t.Errorf("soak record = %+v", rec)
+	}
+}
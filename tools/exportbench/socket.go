@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/collector/config/configopaque"
+	"go.opentelemetry.io/collector/config/configtls"
+)
+
+// socketBytes is what crossed a server's sockets: in from the exporter, out
+// to it. Unlike the payload counters, it includes HTTP/2 frames, HTTP
+// headers, responses and TLS records.
+type socketBytes struct {
+	in  int64
+	out int64
+}
+
+// socketCounter tracks cumulative socket bytes in both directions, and the
+// connections currently open.
+type socketCounter struct {
+	in   atomic.Int64
+	out  atomic.Int64
+	open atomic.Int64
+}
+
+func (c *socketCounter) ReadAndReset() socketBytes {
+	return socketBytes{in: c.in.Swap(0), out: c.out.Swap(0)}
+}
+
+// Open returns the number of accepted connections not yet closed.
+func (c *socketCounter) Open() int64 { return c.open.Load() }
+
+// countingListener counts the bytes read from and written to every
+// connection it accepts.
+type countingListener struct {
+	net.Listener
+	counter *socketCounter
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	l.counter.open.Add(1)
+	return &countingConn{Conn: c, counter: l.counter}, nil
+}
+
+type countingConn struct {
+	net.Conn
+	counter *socketCounter
+	closed  atomic.Bool
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.counter.in.Add(int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.counter.out.Add(int64(n))
+	return n, err
+}
+
+func (c *countingConn) Close() error {
+	if !c.closed.Swap(true) {
+		c.counter.open.Add(-1)
+	}
+	return c.Conn.Close()
+}
+
+// localTLS is a self-signed certificate for localhost, generated per run,
+// that the nop servers present in --tls mode and the exporters trust.
+type localTLS struct {
+	cert  tls.Certificate
+	caPEM []byte
+}
+
+func newLocalTLS() (*localTLS, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "exportbench"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("create certificate: %w", err)
+	}
+	return &localTLS{
+		cert:  tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key},
+		caPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}, nil
+}
+
+// serverConfig returns the server side, offering protos through ALPN.
+func (t *localTLS) serverConfig(protos ...string) *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{t.cert},
+		NextProtos:   protos,
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+// clientTLS returns the exporter TLS settings for a server with t, which is
+// nil for plaintext servers.
+func clientTLS(t *localTLS) configtls.ClientConfig {
+	if t == nil {
+		return configtls.ClientConfig{Insecure: true}
+	}
+	return configtls.ClientConfig{Config: configtls.Config{CAPem: configopaque.String(t.caPEM)}}
+}
+
+// scenarioTLS is clientTLS as scenario config keys.
+func scenarioTLS(t *localTLS) map[string]any {
+	if t == nil {
+		return map[string]any{"insecure": true}
+	}
+	return map[string]any{"insecure": false, "ca_pem": string(t.caPEM)}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	"go.opentelemetry.io/collector/exporter/otlphttpexporter"
+)
+
+func TestSocketBytes(t *testing.T) {
+	lt, err := newLocalTLS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, transport := range []string{"grpc", "http"} {
+		var plain socketBytes
+		for _, tlsCert := range []*localTLS{nil, lt} {
+			opts := serverOptions{tls: tlsCert}
+			var f benchFormat
+			switch transport {
+			case "grpc":
+				srv, err := startGRPCServer(opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer srv.Stop()
+				f = newGRPCFormat("socket", testSignal, srv, codec{}, queueMode{})
+			case "http":
+				srv, err := startHTTPServer(opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer srv.Stop()
+				f = newHTTPFormat("socket", testSignal, srv, otlphttpexporter.EncodingProto, codec{}, queueMode{})
+			}
+			if err := f.setup(); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.export(testPayloads); err != nil {
+				t.Fatalf("%s, tls %v: %v", transport, tlsCert != nil, err)
+			}
+			size, socket := f.size(), f.socket()
+			f.cleanup()
+
+			// The sockets carry the payload plus framing, and responses
+			// back.
+			if socket.in <= size || socket.out == 0 {
+				t.Errorf("%s, tls %v: socket %+v for %d payload bytes", transport, tlsCert != nil, socket, size)
+			}
+			if tlsCert == nil {
+				plain = socket
+			} else if socket.in <= plain.in {
+				t.Errorf("%s: %d bytes in with TLS, %d without", transport, socket.in, plain.in)
+			}
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"math"
+	"slices"
+)
+
+// distribution summarizes repeated measurements of one quantity.
+type distribution struct {
+	Min      float64 `json:"min"`
+	P50      float64 `json:"p50"`
+	P90      float64 `json:"p90"`
+	P99      float64 `json:"p99"`
+	Max      float64 `json:"max"`
+	Mean     float64 `json:"mean"`
+	Stddev   float64 `json:"stddev"`
+	CI95Low  float64 `json:"ci95_low"`
+	CI95High float64 `json:"ci95_high"`
+	CV       float64 `json:"cv"`
+}
+
+func summarize(xs []float64) distribution {
+	if len(xs) == 0 {
+		return distribution{}
+	}
+	sorted := slices.Clone(xs)
+	slices.Sort(sorted)
+
+	d := distribution{
+		Min:    sorted[0],
+		P50:    percentile(sorted, 0.50),
+		P90:    percentile(sorted, 0.90),
+		P99:    percentile(sorted, 0.99),
+		Max:    sorted[len(sorted)-1],
+		Mean:   mean(xs),
+		Stddev: math.Sqrt(variance(xs)),
+	}
+	d.CI95Low, d.CI95High = d.Mean, d.Mean
+	if n := len(xs); n > 1 {
+		half := tQuantile(0.975, float64(n-1)) * d.Stddev / math.Sqrt(float64(n))
+		d.CI95Low, d.CI95High = d.Mean-half, d.Mean+half
+	}
+	if d.Mean != 0 {
+		d.CV = d.Stddev / d.Mean
+	}
+	return d
+}
+
+// percentile interpolates linearly between the closest ranks of sorted.
+func percentile(sorted []float64, q float64) float64 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	pos := q * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	if lo >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	frac := pos - float64(lo)
+	return sorted[lo] + frac*(sorted[lo+1]-sorted[lo])
+}
+
+func mean(xs []float64) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, x := range xs {
+		sum += x
+	}
+	return sum / float64(len(xs))
+}
+
+// variance returns the unbiased sample variance of xs.
+func variance(xs []float64) float64 {
+	if len(xs) < 2 {
+		return 0
+	}
+	m := mean(xs)
+	var ss float64
+	for _, x := range xs {
+		ss += (x - m) * (x - m)
+	}
+	return ss / float64(len(xs)-1)
+}
+
+// welchTTest returns the two-sided p-value of Welch's t-test for the
+// hypothesis that a and b have the same mean. ok is false when either side
+// has fewer than two samples.
+func welchTTest(a, b []float64) (p float64, ok bool) {
+	if len(a) < 2 || len(b) < 2 {
+		return 0, false
+	}
+	na, nb := float64(len(a)), float64(len(b))
+	va, vb := variance(a)/na, variance(b)/nb
+	diff := mean(a) - mean(b)
+
+	if va+vb == 0 {
+		if diff == 0 {
+			return 1, true
+		}
+		return 0, true
+	}
+
+	t := diff / math.Sqrt(va+vb)
+	df := (va + vb) * (va + vb) / (va*va/(na-1) + vb*vb/(nb-1))
+	return regIncBeta(df/2, 0.5, df/(df+t*t)), true
+}
+
+// studentTCDF is the cumulative distribution function of Student's t.
+func studentTCDF(t, df float64) float64 {
+	tail := 0.5 * regIncBeta(df/2, 0.5, df/(df+t*t))
+	if t > 0 {
+		return 1 - tail
+	}
+	return tail
+}
+
+// tQuantile inverts studentTCDF by bisection.
+func tQuantile(p, df float64) float64 {
+	lo, hi := -1e3, 1e3
+	for i := 0; i < 100; i++ {
+		mid := (lo + hi) / 2
+		if studentTCDF(mid, df) < p {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
+
+// regIncBeta evaluates the regularized incomplete beta function I_x(a, b)
+// with the continued fraction from Numerical Recipes.
+func regIncBeta(a, b, x float64) float64 {
+	switch {
+	case x <= 0:
+		return 0
+	case x >= 1:
+		return 1
+	}
+	lga, _ := math.Lgamma(a)
+	lgb, _ := math.Lgamma(b)
+	lgab, _ := math.Lgamma(a + b)
+	front := math.Exp(lgab - lga - lgb + a*math.Log(x) + b*math.Log(1-x))
+
+	if x < (a+1)/(a+b+2) {
+		return front * betaContinuedFraction(a, b, x) / a
+	}
+	return 1 - front*betaContinuedFraction(b, a, 1-x)/b
+}
+
+func betaContinuedFraction(a, b, x float64) float64 {
+	const (
+		maxIter = 200
+		eps     = 1e-14
+		tiny    = 1e-300
+	)
+	c, d := 1.0, 1-(a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1; m <= maxIter; m++ {
+		fm := float64(m)
+		num := fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm))
+		d = 1 + num*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + num/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+
+		num = -(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1))
+		d = 1 + num*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + num/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < eps {
+			break
+		}
+	}
+	return h
+}
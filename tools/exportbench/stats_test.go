@@ -0,0 +1,48 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestWelchTTest(t *testing.T) {
+	// Welch example from Wikipedia: t = -2.46, df = 25.0, p = 0.021.
+	a := []float64{27.5, 21.0, 19.0, 23.6, 17.0, 17.9, 16.9, 20.1, 21.9, 22.6, 23.1, 19.6, 19.0, 21.7, 21.4}
+	b := []float64{27.1, 22.0, 20.8, 23.4, 23.4, 23.5, 25.8, 22.0, 24.8, 20.2, 21.9, 22.1, 22.9, 20.5, 24.4}
+	p, ok := welchTTest(a, b)
+	if !ok {
+		t.Fatal("expected a p-value")
+	}
+	if math.Abs(p-0.0214) > 0.0005 {
+		t.Errorf("p = %.4f, want 0.0214", p)
+	}
+
+	if _, ok := welchTTest([]float64{1}, b); ok {
+		t.Error("expected no p-value for a single sample")
+	}
+	if p, _ := welchTTest([]float64{5, 5}, []float64{5, 5}); p != 1 {
+		t.Errorf("identical constant samples: p = %v, want 1", p)
+	}
+	if p, _ := welchTTest([]float64{5, 5}, []float64{6, 6}); p != 0 {
+		t.Errorf("different constant samples: p = %v, want 0", p)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	xs := []float64{5, 1, 4, 2, 3}
+	d := summarize(xs)
+	if d.Min != 1 || d.Max != 5 || d.P50 != 3 || d.Mean != 3 {
+		t.Errorf("unexpected summary: %+v", d)
+	}
+	if math.Abs(d.P90-4.6) > 1e-9 {
+		t.Errorf("p90 = %v, want 4.6", d.P90)
+	}
+	// stddev = sqrt(2.5); t(0.975, 4) = 2.776.
+	half := 2.776 * math.Sqrt(2.5) / math.Sqrt(5)
+	if math.Abs(d.CI95High-(3+half)) > 1e-3 || math.Abs(d.CI95Low-(3-half)) > 1e-3 {
+		t.Errorf("CI = [%v, %v], want 3 +- %v", d.CI95Low, d.CI95High, half)
+	}
+	if math.Abs(d.CV-math.Sqrt(2.5)/3) > 1e-9 {
+		t.Errorf("CV = %v", d.CV)
+	}
+}
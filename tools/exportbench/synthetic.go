@@ -0,0 +1,355 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+)
+
+// syntheticConfig controls the shape of generated payloads. The same config
+// and seed always produce byte-identical payloads.
+type syntheticConfig struct {
+	seed               uint64
+	files              int
+	resources          int
+	metricsPerResource int
+	pointsPerMetric    int
+	recordsPerResource int
+	attrsPerItem       int
+	attrCardinality    int
+	pointTypes         string
+	bodySize           int
+	bodySizeDist       string
+}
+
+func (c *syntheticConfig) registerFlags(fs *flag.FlagSet) {
+	fs.Uint64Var(&c.seed, "seed", 1, "synthetic: random seed")
+	fs.IntVar(&c.files, "files", 20, "synthetic: number of payload files")
+	fs.IntVar(&c.resources, "resources", 10, "synthetic: resources per payload")
+	fs.IntVar(&c.metricsPerResource, "metrics-per-resource", 20, "synthetic: metrics per resource")
+	fs.IntVar(&c.pointsPerMetric, "points-per-metric", 10, "synthetic: data points per metric")
+	fs.IntVar(&c.recordsPerResource, "records-per-resource", 200, "synthetic: log records per resource")
+	fs.IntVar(&c.attrsPerItem, "attrs-per-item", 4, "synthetic: attributes per data point or log record")
+	fs.IntVar(&c.attrCardinality, "attr-cardinality", 50, "synthetic: distinct values per attribute key")
+	fs.StringVar(&c.pointTypes, "point-types", "sum,gauge,histogram,exponential_histogram,summary", "synthetic: comma-separated metric types, assigned round-robin")
+	fs.IntVar(&c.bodySize, "body-size", 200, "synthetic: mean log body size in bytes")
+	fs.StringVar(&c.bodySizeDist, "body-size-dist", "exponential", "synthetic: log body size distribution: fixed, uniform or exponential")
+}
+
+// defaultSyntheticConfig returns the config produced by registerFlags when no
+// flags are set.
+func defaultSyntheticConfig() syntheticConfig {
+	var cfg syntheticConfig
+	cfg.registerFlags(flag.NewFlagSet("defaults", flag.ContinueOnError))
+	return cfg
+}
+
+func (c *syntheticConfig) validate() error {
+	if c.files < 1 || c.resources < 1 {
+		return fmt.Errorf("files and resources must be positive")
+	}
+	if c.attrCardinality < 1 {
+		return fmt.Errorf("attr-cardinality must be positive")
+	}
+	if c.metricsPerResource < 0 || c.pointsPerMetric < 0 || c.recordsPerResource < 0 || c.attrsPerItem < 0 {
+		return fmt.Errorf("metrics-per-resource, points-per-metric, records-per-resource and attrs-per-item must not be negative")
+	}
+	if c.bodySize < 0 {
+		return fmt.Errorf("body-size must not be negative")
+	}
+	if _, err := parsePointTypes(c.pointTypes); err != nil {
+		return err
+	}
+	switch c.bodySizeDist {
+	case "fixed", "uniform", "exponential":
+	default:
+		return fmt.Errorf("unknown body-size-dist %q (want fixed, uniform or exponential)", c.bodySizeDist)
+	}
+	return nil
+}
+
+func parsePointTypes(s string) ([]pmetric.MetricType, error) {
+	var types []pmetric.MetricType
+	for _, name := range strings.Split(s, ",") {
+		switch strings.TrimSpace(name) {
+		case "sum":
+			types = append(types, pmetric.MetricTypeSum)
+		case "gauge":
+			types = append(types, pmetric.MetricTypeGauge)
+		case "histogram":
+			types = append(types, pmetric.MetricTypeHistogram)
+		case "exponential_histogram":
+			types = append(types, pmetric.MetricTypeExponentialHistogram)
+		case "summary":
+			types = append(types, pmetric.MetricTypeSummary)
+		default:
+			return nil, fmt.Errorf("unknown point type %q", name)
+		}
+	}
+	return types, nil
+}
+
+// syntheticStart anchors generated timestamps so output does not depend on
+// the wall clock.
+var syntheticStart = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var histogramBounds = []float64{0, 5, 10, 25, 50, 100, 250, 500, 1000, 2500}
+
+var bodyWords = []string{
+	"request", "completed", "failed", "user", "session", "cache", "miss", "hit",
+	"upstream", "timeout", "retrying", "connection", "established", "closed",
+	"GET", "POST", "/api/v1/orders", "/healthz", "status=200", "status=500",
+}
+
+// generatePayloads builds cfg.files deterministic export requests of the
+// given signal. It returns the same shape as loadPayloads.
+func generatePayloads(cfg syntheticConfig, sig signal) ([]payload, int64, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, 0, err
+	}
+	pointTypes, _ := parsePointTypes(cfg.pointTypes)
+	rng := rand.New(rand.NewPCG(cfg.seed, cfg.seed))
+
+	var payloads []payload
+	var totalRawBytes int64
+	for i := 0; i < cfg.files; i++ {
+		filename := fmt.Sprintf("%04d.pb", i)
+		ts := syntheticStart.Add(time.Duration(i) * 10 * time.Second)
+
+		var p payload
+		var err error
+		switch sig {
+		case signalMetrics:
+			req := pmetricotlp.NewExportRequestFromMetrics(generateMetrics(rng, cfg, pointTypes, ts))
+			p = payload{filename: filename, signal: sig, metrics: req}
+			p.raw, err = req.MarshalProto()
+		case signalLogs:
+			req := plogotlp.NewExportRequestFromLogs(generateLogs(rng, cfg, ts))
+			p = payload{filename: filename, signal: sig, logs: req}
+			p.raw, err = req.MarshalProto()
+		default:
+			return nil, 0, fmt.Errorf("synthetic payloads are not supported for %s", sig)
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("marshaling %s: %w", filename, err)
+		}
+
+		payloads = append(payloads, p)
+		totalRawBytes += int64(len(p.raw))
+	}
+	return payloads, totalRawBytes, nil
+}
+
+func fillResource(res pcommon.Resource, r int) {
+	attrs := res.Attributes()
+	attrs.PutStr("service.name", fmt.Sprintf("service-%d", r))
+	attrs.PutStr("service.namespace", "exportbench")
+	attrs.PutStr("host.name", fmt.Sprintf("node-%d.cluster.local", r%8))
+	attrs.PutStr("k8s.pod.name", fmt.Sprintf("service-%d-7d9f8c6b5-%05d", r, r*7919%100000))
+}
+
+func fillAttributes(rng *rand.Rand, attrs pcommon.Map, cfg syntheticConfig) {
+	for k := 0; k < cfg.attrsPerItem; k++ {
+		attrs.PutStr(fmt.Sprintf("attr.%d", k), fmt.Sprintf("value-%d", rng.IntN(cfg.attrCardinality)))
+	}
+}
+
+func generateMetrics(rng *rand.Rand, cfg syntheticConfig, pointTypes []pmetric.MetricType, ts time.Time) pmetric.Metrics {
+	md := pmetric.NewMetrics()
+	start := pcommon.NewTimestampFromTime(syntheticStart)
+	now := pcommon.NewTimestampFromTime(ts)
+
+	for r := 0; r < cfg.resources; r++ {
+		rm := md.ResourceMetrics().AppendEmpty()
+		fillResource(rm.Resource(), r)
+		sm := rm.ScopeMetrics().AppendEmpty()
+		sm.Scope().SetName("exportbench/synthetic")
+
+		for m := 0; m < cfg.metricsPerResource; m++ {
+			metric := sm.Metrics().AppendEmpty()
+			metric.SetName(fmt.Sprintf("synthetic.metric.%d", m))
+			metric.SetUnit("1")
+
+			switch pointTypes[m%len(pointTypes)] {
+			case pmetric.MetricTypeSum:
+				sum := metric.SetEmptySum()
+				sum.SetIsMonotonic(true)
+				sum.SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+				for d := 0; d < cfg.pointsPerMetric; d++ {
+					dp := sum.DataPoints().AppendEmpty()
+					dp.SetStartTimestamp(start)
+					dp.SetTimestamp(now)
+					dp.SetIntValue(rng.Int64N(1_000_000))
+					fillAttributes(rng, dp.Attributes(), cfg)
+				}
+			case pmetric.MetricTypeGauge:
+				gauge := metric.SetEmptyGauge()
+				for d := 0; d < cfg.pointsPerMetric; d++ {
+					dp := gauge.DataPoints().AppendEmpty()
+					dp.SetTimestamp(now)
+					dp.SetDoubleValue(rng.Float64() * 100)
+					fillAttributes(rng, dp.Attributes(), cfg)
+				}
+			case pmetric.MetricTypeHistogram:
+				hist := metric.SetEmptyHistogram()
+				hist.SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+				for d := 0; d < cfg.pointsPerMetric; d++ {
+					dp := hist.DataPoints().AppendEmpty()
+					dp.SetStartTimestamp(start)
+					dp.SetTimestamp(now)
+					dp.ExplicitBounds().FromRaw(histogramBounds)
+					var count uint64
+					for b := 0; b <= len(histogramBounds); b++ {
+						n := rng.Uint64N(100)
+						dp.BucketCounts().Append(n)
+						count += n
+					}
+					dp.SetCount(count)
+					dp.SetSum(float64(count) * rng.Float64() * 100)
+					fillAttributes(rng, dp.Attributes(), cfg)
+				}
+			case pmetric.MetricTypeExponentialHistogram:
+				hist := metric.SetEmptyExponentialHistogram()
+				hist.SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+				for d := 0; d < cfg.pointsPerMetric; d++ {
+					dp := hist.DataPoints().AppendEmpty()
+					dp.SetStartTimestamp(start)
+					dp.SetTimestamp(now)
+					dp.SetScale(3)
+					dp.Positive().SetOffset(int32(rng.IntN(10)))
+					dp.SetZeroCount(rng.Uint64N(5))
+					count := dp.ZeroCount()
+					for b := 0; b < 16; b++ {
+						n := rng.Uint64N(50)
+						dp.Positive().BucketCounts().Append(n)
+						count += n
+					}
+					dp.SetCount(count)
+					dp.SetSum(float64(count) * rng.Float64() * 10)
+					fillAttributes(rng, dp.Attributes(), cfg)
+				}
+			case pmetric.MetricTypeSummary:
+				summary := metric.SetEmptySummary()
+				for d := 0; d < cfg.pointsPerMetric; d++ {
+					dp := summary.DataPoints().AppendEmpty()
+					dp.SetStartTimestamp(start)
+					dp.SetTimestamp(now)
+					dp.SetCount(rng.Uint64N(10_000))
+					dp.SetSum(float64(dp.Count()) * rng.Float64())
+					for _, q := range []float64{0.5, 0.9, 0.99} {
+						qv := dp.QuantileValues().AppendEmpty()
+						qv.SetQuantile(q)
+						qv.SetValue(q * rng.Float64() * 1000)
+					}
+					fillAttributes(rng, dp.Attributes(), cfg)
+				}
+			}
+		}
+	}
+	return md
+}
+
+func generateLogs(rng *rand.Rand, cfg syntheticConfig, ts time.Time) plog.Logs {
+	ld := plog.NewLogs()
+	severities := []plog.SeverityNumber{plog.SeverityNumberDebug, plog.SeverityNumberInfo, plog.SeverityNumberWarn, plog.SeverityNumberError}
+
+	for r := 0; r < cfg.resources; r++ {
+		rl := ld.ResourceLogs().AppendEmpty()
+		fillResource(rl.Resource(), r)
+		sl := rl.ScopeLogs().AppendEmpty()
+		sl.Scope().SetName("exportbench/synthetic")
+
+		for l := 0; l < cfg.recordsPerResource; l++ {
+			lr := sl.LogRecords().AppendEmpty()
+			recordTime := pcommon.NewTimestampFromTime(ts.Add(time.Duration(l) * time.Millisecond))
+			lr.SetTimestamp(recordTime)
+			lr.SetObservedTimestamp(recordTime)
+			sev := severities[rng.IntN(len(severities))]
+			lr.SetSeverityNumber(sev)
+			lr.SetSeverityText(sev.String())
+			lr.Body().SetStr(syntheticBody(rng, cfg))
+			fillAttributes(rng, lr.Attributes(), cfg)
+		}
+	}
+	return ld
+}
+
+// syntheticBody builds a log line from a small vocabulary so that bodies
+// compress roughly like real application logs.
+func syntheticBody(rng *rand.Rand, cfg syntheticConfig) string {
+	size := cfg.bodySize
+	switch cfg.bodySizeDist {
+	case "uniform":
+		size = rng.IntN(2*cfg.bodySize + 1)
+	case "exponential":
+		size = int(math.Round(rng.ExpFloat64() * float64(cfg.bodySize)))
+	}
+
+	var sb strings.Builder
+	sb.Grow(size + 16)
+	for sb.Len() < size {
+		if sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(bodyWords[rng.IntN(len(bodyWords))])
+	}
+	body := sb.String()
+	if len(body) > size {
+		body = body[:size]
+	}
+	return body
+}
+
+// runGenerate implements the generate subcommand, which writes synthetic
+// payloads to a directory usable as --input-dir.
+func runGenerate(args []string) error {
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	outputDir := fs.String("output-dir", "", "directory to write .pb files to (required)")
+	signalName := fs.String("signal", string(signalMetrics), "signal to generate: metrics or logs")
+	var cfg syntheticConfig
+	cfg.registerFlags(fs)
+	fs.Parse(args)
+
+	if *outputDir == "" {
+		fs.Usage()
+		return fmt.Errorf("--output-dir is required")
+	}
+	sig, err := parseSignal(*signalName)
+	if err != nil {
+		return err
+	}
+	if sig != signalMetrics && sig != signalLogs {
+		return fmt.Errorf("generate supports metrics and logs, not %s", sig)
+	}
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	payloads, totalRawBytes, err := generatePayloads(cfg, sig)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*outputDir, 0o755); err != nil {
+		return err
+	}
+	for _, p := range payloads {
+		if err := os.WriteFile(filepath.Join(*outputDir, p.filename), p.raw, 0o644); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "wrote %d %s payloads (%.1f MB) to %s\n",
+		len(payloads), sig, float64(totalRawBytes)/1024/1024, *outputDir)
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+func TestGeneratePayloadsDeterministic(t *testing.T) {
+	cfg := defaultSyntheticConfig()
+	cfg.files = 3
+
+	for _, sig := range []signal{signalMetrics, signalLogs} {
+		a, aBytes, err := generatePayloads(cfg, sig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, bBytes, err := generatePayloads(cfg, sig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if aBytes != bBytes {
+			t.Fatalf("%s: total bytes differ: %d vs %d", sig, aBytes, bBytes)
+		}
+		for i := range a {
+			if !bytes.Equal(a[i].raw, b[i].raw) {
+				t.Fatalf("%s: payload %s differs between runs", sig, a[i].filename)
+			}
+		}
+
+		cfg.seed++
+		c, _, err := generatePayloads(cfg, sig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.seed--
+		if bytes.Equal(a[0].raw, c[0].raw) {
+			t.Fatalf("%s: different seeds produced identical payloads", sig)
+		}
+	}
+}
+
+func TestGeneratePayloadsPointTypes(t *testing.T) {
+	cfg := defaultSyntheticConfig()
+	cfg.files = 1
+	cfg.metricsPerResource = 5
+
+	payloads, _, err := generatePayloads(cfg, signalMetrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[pmetric.MetricType]int{}
+	metrics := payloads[0].metrics.Metrics().ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics()
+	for i := 0; i < metrics.Len(); i++ {
+		seen[metrics.At(i).Type()]++
+	}
+	for _, typ := range []pmetric.MetricType{
+		pmetric.MetricTypeSum,
+		pmetric.MetricTypeGauge,
+		pmetric.MetricTypeHistogram,
+		pmetric.MetricTypeExponentialHistogram,
+		pmetric.MetricTypeSummary,
+	} {
+		if seen[typ] != 1 {
+			t.Errorf("expected one %s metric, got %d", typ, seen[typ])
+		}
+	}
+
+	want := cfg.resources * cfg.metricsPerResource * cfg.pointsPerMetric
+	if got := payloads[0].itemCount(); got != want {
+		t.Errorf("data points = %d, want %d", got, want)
+	}
+}
+
+func TestSyntheticConfigValidate(t *testing.T) {
+	for name, modify := range map[string]func(*syntheticConfig){
+		"body-size":         func(c *syntheticConfig) { c.bodySize = -1 },
+		"points-per-metric": func(c *syntheticConfig) { c.pointsPerMetric = -1 },
+		"files":             func(c *syntheticConfig) { c.files = 0 },
+		"body-size-dist":    func(c *syntheticConfig) { c.bodySizeDist = "normal" },
+	} {
+		cfg := defaultSyntheticConfig()
+		modify(&cfg)
+		if err := cfg.validate(); err == nil {
+			t.Errorf("%s: validate accepted an invalid config", name)
+		}
+	}
+	cfg := defaultSyntheticConfig()
+	if err := cfg.validate(); err != nil {
+		t.Errorf("validate rejected the defaults: %v", err)
+	}
+}
+
+func TestRunGenerateRejectsSignal(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out")
+	for _, sig := range []string{"auto", "traces"} {
+		if err := runGenerate([]string{"--output-dir", dir, "--signal", sig}); err == nil {
+			t.Errorf("runGenerate accepted --signal %s", sig)
+		}
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("runGenerate created %s before failing", dir)
+	}
+}
+
+func TestDetectSignal(t *testing.T) {
+	cfg := defaultSyntheticConfig()
+	cfg.files = 1
+
+	for _, sig := range []signal{signalMetrics, signalLogs} {
+		payloads, _, err := generatePayloads(cfg, sig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := detectSignal(payloads[0].raw)
+		if err != nil {
+			t.Fatalf("%s: %v", sig, err)
+		}
+		if got != sig {
+			t.Errorf("detectSignal = %s, want %s", got, sig)
+		}
+
+		// An unknown top-level field (99, varint 1) does not change the
+		// verdict, although the request no longer re-marshals to its size.
+		got, err = detectSignal(append(slices.Clone(payloads[0].raw), 0x98, 0x06, 0x01))
+		if err != nil || got != sig {
+			t.Errorf("%s with an unknown field: detectSignal = %s, %v", sig, got, err)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+//go:build linux
+
+package main
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// threadCPUTime returns the CPU time consumed by the calling OS thread. The
+// caller must hold runtime.LockOSThread for a difference of two readings
+// to belong to one goroutine.
+func threadCPUTime() time.Duration {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_THREAD_CPUTIME_ID, &ts); err != nil {
+		return 0
+	}
+	return time.Duration(ts.Nano())
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+import "time"
+
+// threadCPUTime is not implemented on this platform and always returns 0.
+func threadCPUTime() time.Duration { return 0 }
@@ -0,0 +1,643 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+)
+
+// fidelityCounts are the quantities --verify checks survive the round trip.
+// Attributes are counted on items (data points, log records, spans) only,
+// since that is all a STEF reader record exposes.
+type fidelityCounts struct {
+	Items      int64 `json:"items"`
+	Attributes int64 `json:"attributes"`
+	Exemplars  int64 `json:"exemplars"`
+}
+
+func (c *fidelityCounts) add(o fidelityCounts) {
+	c.Items += o.Items
+	c.Attributes += o.Attributes
+	c.Exemplars += o.Exemplars
+}
+
+// countFidelity tallies items, item attributes and exemplars in a payload.
+func countFidelity(p payload) fidelityCounts {
+	var c fidelityCounts
+	switch p.signal {
+	case signalMetrics:
+		rms := p.metrics.Metrics().ResourceMetrics()
+		for i := 0; i < rms.Len(); i++ {
+			sms := rms.At(i).ScopeMetrics()
+			for j := 0; j < sms.Len(); j++ {
+				ms := sms.At(j).Metrics()
+				for k := 0; k < ms.Len(); k++ {
+					c.add(countMetric(ms.At(k)))
+				}
+			}
+		}
+	case signalLogs:
+		rls := p.logs.Logs().ResourceLogs()
+		for i := 0; i < rls.Len(); i++ {
+			sls := rls.At(i).ScopeLogs()
+			for j := 0; j < sls.Len(); j++ {
+				lrs := sls.At(j).LogRecords()
+				for k := 0; k < lrs.Len(); k++ {
+					c.Items++
+					c.Attributes += int64(lrs.At(k).Attributes().Len())
+				}
+			}
+		}
+	case signalTraces:
+		rss := p.traces.Traces().ResourceSpans()
+		for i := 0; i < rss.Len(); i++ {
+			sss := rss.At(i).ScopeSpans()
+			for j := 0; j < sss.Len(); j++ {
+				spans := sss.At(j).Spans()
+				for k := 0; k < spans.Len(); k++ {
+					c.Items++
+					c.Attributes += int64(spans.At(k).Attributes().Len())
+				}
+			}
+		}
+	case signalProfiles:
+		// Profile sample attributes are indices into a shared dictionary,
+		// so only samples are counted.
+		c.Items = int64(p.profiles.Profiles().SampleCount())
+	}
+	return c
+}
+
+func countMetric(m pmetric.Metric) fidelityCounts {
+	var c fidelityCounts
+	switch m.Type() {
+	case pmetric.MetricTypeGauge:
+		c.addNumberPoints(m.Gauge().DataPoints())
+	case pmetric.MetricTypeSum:
+		c.addNumberPoints(m.Sum().DataPoints())
+	case pmetric.MetricTypeHistogram:
+		dps := m.Histogram().DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			c.Items++
+			c.Attributes += int64(dps.At(i).Attributes().Len())
+			c.Exemplars += int64(dps.At(i).Exemplars().Len())
+		}
+	case pmetric.MetricTypeExponentialHistogram:
+		dps := m.ExponentialHistogram().DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			c.Items++
+			c.Attributes += int64(dps.At(i).Attributes().Len())
+			c.Exemplars += int64(dps.At(i).Exemplars().Len())
+		}
+	case pmetric.MetricTypeSummary:
+		dps := m.Summary().DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			c.Items++
+			c.Attributes += int64(dps.At(i).Attributes().Len())
+		}
+	}
+	return c
+}
+
+func (c *fidelityCounts) addNumberPoints(dps pmetric.NumberDataPointSlice) {
+	for i := 0; i < dps.Len(); i++ {
+		c.Items++
+		c.Attributes += int64(dps.At(i).Attributes().Len())
+		c.Exemplars += int64(dps.At(i).Exemplars().Len())
+	}
+}
+
+// captureSink collects what a nop server decoded while --verify is
+// checking a format. It is inactive, and costs one atomic load per request,
+// the rest of the time.
+type captureSink struct {
+	enabled  atomic.Bool
+	mu       sync.Mutex
+	payloads []payload
+	counts   fidelityCounts
+	// record, if set, is handed every captured payload instead of the
+	// sink keeping it, as the capture subcommand writes them to disk.
+	record func(payload)
+}
+
+func (s *captureSink) active() bool { return s.enabled.Load() }
+
+func (s *captureSink) start() {
+	s.mu.Lock()
+	s.payloads, s.counts = nil, fidelityCounts{}
+	s.mu.Unlock()
+	s.enabled.Store(true)
+}
+
+// stop disables capturing and returns what was captured since start.
+func (s *captureSink) stop() ([]payload, fidelityCounts) {
+	s.enabled.Store(false)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.payloads, s.counts
+}
+
+func (s *captureSink) capture(p payload) {
+	if !s.active() {
+		return
+	}
+	if s.record != nil {
+		s.record(p)
+		return
+	}
+	c := countFidelity(p)
+	s.mu.Lock()
+	s.payloads = append(s.payloads, p)
+	s.counts.add(c)
+	s.mu.Unlock()
+}
+
+// verification is the outcome of checking one format's round trip.
+type verification struct {
+	Sent     fidelityCounts `json:"sent"`
+	Received fidelityCounts `json:"received"`
+	// ByItem is set when items were matched one by one rather than as
+	// whole requests; Mismatched then counts items.
+	ByItem     bool   `json:"by_item,omitempty"`
+	Mismatched int    `json:"mismatched"`
+	FirstDiff  string `json:"first_diff,omitempty"`
+}
+
+func (v verification) ok() bool {
+	return v.Sent == v.Received && v.Mismatched == 0
+}
+
+// unit names what Mismatched counts.
+func (v verification) unit(sig signal) string {
+	if v.ByItem {
+		return sig.itemName()
+	}
+	return "requests"
+}
+
+// lost returns how many items, attributes and exemplars went missing.
+// Negative values mean the server saw more than was sent.
+func (v verification) lost() fidelityCounts {
+	return fidelityCounts{
+		Items:      v.Sent.Items - v.Received.Items,
+		Attributes: v.Sent.Attributes - v.Received.Attributes,
+		Exemplars:  v.Sent.Exemplars - v.Received.Exemplars,
+	}
+}
+
+// verifyPayloads compares the requests a server decoded with the payloads
+// that were sent. Exporters may reorder requests under concurrency, so
+// requests are matched as a multiset of their canonical encoding, and only
+// the leftovers are paired up, in order, to describe the first difference.
+func verifyPayloads(sent, received []payload) verification {
+	var v verification
+	for _, p := range sent {
+		v.Sent.add(countFidelity(p))
+	}
+	for _, p := range received {
+		v.Received.add(countFidelity(p))
+	}
+
+	pending := map[[sha256.Size]byte][]int{}
+	for i, p := range sent {
+		h := payloadHash(p)
+		pending[h] = append(pending[h], i)
+	}
+	matched := make([]bool, len(sent))
+	var unmatched []payload
+	for _, p := range received {
+		h := payloadHash(p)
+		if idx := pending[h]; len(idx) > 0 {
+			matched[idx[0]] = true
+			pending[h] = idx[1:]
+			continue
+		}
+		unmatched = append(unmatched, p)
+	}
+	var missing []payload
+	for i, p := range sent {
+		if !matched[i] {
+			missing = append(missing, p)
+		}
+	}
+
+	v.Mismatched = max(len(unmatched), len(missing))
+	switch {
+	case len(unmatched) > 0 && len(missing) > 0:
+		v.FirstDiff = fmt.Sprintf("%s: %s", missing[0].filename, diffPayloads(missing[0], unmatched[0]))
+	case len(missing) > 0:
+		v.FirstDiff = fmt.Sprintf("%s: never received", missing[0].filename)
+	case len(unmatched) > 0:
+		v.FirstDiff = "received a request that was never sent"
+	}
+	return v
+}
+
+func payloadHash(p payload) [sha256.Size]byte {
+	b, err := p.marshalProto()
+	if err != nil {
+		return [sha256.Size]byte{}
+	}
+	return sha256.Sum256(b)
+}
+
+// diffPayloads describes the first difference between two payloads, in the
+// spirit of pmetrictest.CompareMetrics: it walks resources, scopes, metrics
+// and data points and stops at the first mismatch.
+func diffPayloads(want, got payload) string {
+	if want.signal != signalMetrics {
+		wc, gc := countFidelity(want), countFidelity(got)
+		if wc != gc {
+			return fmt.Sprintf("counts differ: want %+v, got %+v", wc, gc)
+		}
+		return "encoded payloads differ"
+	}
+
+	wrms, grms := want.metrics.Metrics().ResourceMetrics(), got.metrics.Metrics().ResourceMetrics()
+	if wrms.Len() != grms.Len() {
+		return fmt.Sprintf("resource count: want %d, got %d", wrms.Len(), grms.Len())
+	}
+	for i := 0; i < wrms.Len(); i++ {
+		wr, gr := wrms.At(i), grms.At(i)
+		if !attrsEqual(wr.Resource().Attributes(), gr.Resource().Attributes()) {
+			return fmt.Sprintf("resource %d: attributes differ", i)
+		}
+		wsms, gsms := wr.ScopeMetrics(), gr.ScopeMetrics()
+		if wsms.Len() != gsms.Len() {
+			return fmt.Sprintf("resource %d: scope count: want %d, got %d", i, wsms.Len(), gsms.Len())
+		}
+		for j := 0; j < wsms.Len(); j++ {
+			wms, gms := wsms.At(j).Metrics(), gsms.At(j).Metrics()
+			if wsms.At(j).Scope().Name() != gsms.At(j).Scope().Name() {
+				return fmt.Sprintf("resource %d scope %d: name: want %q, got %q",
+					i, j, wsms.At(j).Scope().Name(), gsms.At(j).Scope().Name())
+			}
+			if wms.Len() != gms.Len() {
+				return fmt.Sprintf("resource %d scope %d: metric count: want %d, got %d", i, j, wms.Len(), gms.Len())
+			}
+			for k := 0; k < wms.Len(); k++ {
+				if d := diffMetric(wms.At(k), gms.At(k)); d != "" {
+					return fmt.Sprintf("metric %q: %s", wms.At(k).Name(), d)
+				}
+			}
+		}
+	}
+	return "encoded payloads differ"
+}
+
+func diffMetric(want, got pmetric.Metric) string {
+	if want.Name() != got.Name() {
+		return fmt.Sprintf("name: got %q", got.Name())
+	}
+	if want.Type() != got.Type() {
+		return fmt.Sprintf("type: want %s, got %s", want.Type(), got.Type())
+	}
+	wc, gc := countMetric(want), countMetric(got)
+	switch {
+	case wc.Items != gc.Items:
+		return fmt.Sprintf("data points: want %d, got %d", wc.Items, gc.Items)
+	case wc.Attributes != gc.Attributes:
+		return fmt.Sprintf("data point attributes: want %d, got %d", wc.Attributes, gc.Attributes)
+	case wc.Exemplars != gc.Exemplars:
+		return fmt.Sprintf("exemplars: want %d, got %d", wc.Exemplars, gc.Exemplars)
+	}
+	if !metricEncodingEqual(want, got) {
+		return "data point values differ"
+	}
+	return ""
+}
+
+// metricEncodingEqual compares two metrics by their protobuf encoding.
+func metricEncodingEqual(a, b pmetric.Metric) bool {
+	var m pmetric.ProtoMarshaler
+	ab, aErr := m.MarshalMetrics(wrapMetric(a))
+	bb, bErr := m.MarshalMetrics(wrapMetric(b))
+	return aErr == nil && bErr == nil && bytes.Equal(ab, bb)
+}
+
+func wrapMetric(m pmetric.Metric) pmetric.Metrics {
+	md := pmetric.NewMetrics()
+	m.CopyTo(md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty())
+	return md
+}
+
+func attrsEqual(a, b pcommon.Map) bool {
+	return reflect.DeepEqual(a.AsRaw(), b.AsRaw())
+}
+
+// verifyItems compares what a server decoded with what was sent item by
+// item, for exporters that regroup items into requests of their own and
+// reorder resources, scopes and attributes, as OTel Arrow and STEF do. Each
+// item is keyed by a hash of its canonical encoding together with its
+// resource, scope and metric, and the keys are matched as a multiset. Only
+// the hashes and the items' positions are kept; the few items needed to
+// describe the first difference are rebuilt from the payloads.
+func verifyItems(sent, received []payload) (verification, error) {
+	v := verification{ByItem: true}
+	pending := map[[sha256.Size]byte][]itemRef{}
+	for i, p := range sent {
+		v.Sent.add(countFidelity(p))
+		err := hashItems(p, func(n int, _ string, h [sha256.Size]byte) {
+			pending[h] = append(pending[h], itemRef{payload: i, item: n})
+		})
+		if err != nil {
+			return verification{}, err
+		}
+	}
+	var unmatched []itemRef
+	for i, p := range received {
+		v.Received.add(countFidelity(p))
+		err := hashItems(p, func(n int, name string, h [sha256.Size]byte) {
+			if refs := pending[h]; len(refs) > 0 {
+				pending[h] = refs[1:]
+				return
+			}
+			unmatched = append(unmatched, itemRef{payload: i, item: n, name: name})
+		})
+		if err != nil {
+			return verification{}, err
+		}
+	}
+	var missing []itemRef
+	for _, refs := range pending {
+		missing = append(missing, refs...)
+	}
+	slices.SortFunc(missing, func(a, b itemRef) int {
+		if a.payload != b.payload {
+			return a.payload - b.payload
+		}
+		return a.item - b.item
+	})
+
+	v.Mismatched = max(len(unmatched), len(missing))
+	switch {
+	case len(missing) > 0:
+		p := sent[missing[0].payload]
+		name, want := itemAt(p, missing[0].item)
+		v.FirstDiff = fmt.Sprintf("%s: %s never received intact", p.filename, name)
+		for _, ref := range unmatched {
+			if ref.name == name {
+				_, got := itemAt(received[ref.payload], ref.item)
+				v.FirstDiff = fmt.Sprintf("%s: %s: %s", p.filename, name, diffItems(want, got))
+				break
+			}
+		}
+	case len(unmatched) > 0:
+		v.FirstDiff = fmt.Sprintf("received %s that was never sent", unmatched[0].name)
+	}
+	return v, nil
+}
+
+// itemRef locates an item by its payload and its position among the
+// payload's canonical items. name is only kept for unmatched items.
+type itemRef struct {
+	payload int
+	item    int
+	name    string
+}
+
+// hashItems calls fn with the position, name and canonical hash of every
+// item in p.
+func hashItems(p payload, fn func(n int, name string, h [sha256.Size]byte)) error {
+	var err error
+	n := 0
+	eachItem(p, func(name string, one payload) bool {
+		b, mErr := one.marshalProto()
+		if mErr != nil {
+			err = fmt.Errorf("%s: marshal %s: %w", p.filename, name, mErr)
+			return false
+		}
+		fn(n, name, sha256.Sum256(b))
+		n++
+		return true
+	})
+	return err
+}
+
+// itemAt rebuilds the n-th canonical item of p.
+func itemAt(p payload, n int) (name string, item payload) {
+	i := 0
+	eachItem(p, func(itemName string, one payload) bool {
+		if i < n {
+			i++
+			return true
+		}
+		name, item = itemName, one
+		return false
+	})
+	return name, item
+}
+
+// eachItem splits a payload into canonical items, in payload order, and
+// calls fn with each until it returns false. A canonical item is one data
+// point, log record or span on its own, with its resource and scope, and
+// its attributes in key order. Profiles are not split, as no regrouping
+// exporter carries them.
+func eachItem(p payload, fn func(name string, one payload) bool) {
+	switch p.signal {
+	case signalMetrics:
+		rms := p.metrics.Metrics().ResourceMetrics()
+		for i := 0; i < rms.Len(); i++ {
+			sms := rms.At(i).ScopeMetrics()
+			for j := 0; j < sms.Len(); j++ {
+				ms := sms.At(j).Metrics()
+				for k := 0; k < ms.Len(); k++ {
+					m := ms.At(k)
+					for d := range int(countMetric(m).Items) {
+						md := pmetric.NewMetrics()
+						rm := md.ResourceMetrics().AppendEmpty()
+						rms.At(i).Resource().CopyTo(rm.Resource())
+						rm.SetSchemaUrl(rms.At(i).SchemaUrl())
+						sm := rm.ScopeMetrics().AppendEmpty()
+						sms.At(j).Scope().CopyTo(sm.Scope())
+						sm.SetSchemaUrl(sms.At(j).SchemaUrl())
+						copyDataPoint(m, d, sm.Metrics().AppendEmpty())
+						sortAttributes(rm.Resource().Attributes())
+						sortAttributes(sm.Scope().Attributes())
+						if !fn(fmt.Sprintf("metric %q", m.Name()), payload{signal: p.signal, metrics: pmetricotlp.NewExportRequestFromMetrics(md)}) {
+							return
+						}
+					}
+				}
+			}
+		}
+	case signalLogs:
+		rls := p.logs.Logs().ResourceLogs()
+		for i := 0; i < rls.Len(); i++ {
+			sls := rls.At(i).ScopeLogs()
+			for j := 0; j < sls.Len(); j++ {
+				lrs := sls.At(j).LogRecords()
+				for k := 0; k < lrs.Len(); k++ {
+					ld := plog.NewLogs()
+					rl := ld.ResourceLogs().AppendEmpty()
+					rls.At(i).Resource().CopyTo(rl.Resource())
+					rl.SetSchemaUrl(rls.At(i).SchemaUrl())
+					sl := rl.ScopeLogs().AppendEmpty()
+					sls.At(j).Scope().CopyTo(sl.Scope())
+					sl.SetSchemaUrl(sls.At(j).SchemaUrl())
+					lr := sl.LogRecords().AppendEmpty()
+					lrs.At(k).CopyTo(lr)
+					sortAttributes(rl.Resource().Attributes())
+					sortAttributes(sl.Scope().Attributes())
+					sortAttributes(lr.Attributes())
+					if lr.Body().Type() == pcommon.ValueTypeMap {
+						sortAttributes(lr.Body().Map())
+					}
+					if !fn("log record", payload{signal: p.signal, logs: plogotlp.NewExportRequestFromLogs(ld)}) {
+						return
+					}
+				}
+			}
+		}
+	case signalTraces:
+		rss := p.traces.Traces().ResourceSpans()
+		for i := 0; i < rss.Len(); i++ {
+			sss := rss.At(i).ScopeSpans()
+			for j := 0; j < sss.Len(); j++ {
+				spans := sss.At(j).Spans()
+				for k := 0; k < spans.Len(); k++ {
+					td := ptrace.NewTraces()
+					rs := td.ResourceSpans().AppendEmpty()
+					rss.At(i).Resource().CopyTo(rs.Resource())
+					rs.SetSchemaUrl(rss.At(i).SchemaUrl())
+					ss := rs.ScopeSpans().AppendEmpty()
+					sss.At(j).Scope().CopyTo(ss.Scope())
+					ss.SetSchemaUrl(sss.At(j).SchemaUrl())
+					span := ss.Spans().AppendEmpty()
+					spans.At(k).CopyTo(span)
+					sortAttributes(rs.Resource().Attributes())
+					sortAttributes(ss.Scope().Attributes())
+					sortAttributes(span.Attributes())
+					for e := 0; e < span.Events().Len(); e++ {
+						sortAttributes(span.Events().At(e).Attributes())
+					}
+					for l := 0; l < span.Links().Len(); l++ {
+						sortAttributes(span.Links().At(l).Attributes())
+					}
+					if !fn(fmt.Sprintf("span %q", span.Name()), payload{signal: p.signal, traces: ptraceotlp.NewExportRequestFromTraces(td)}) {
+						return
+					}
+				}
+			}
+		}
+	default:
+		fn(string(p.signal), p)
+	}
+}
+
+// copyDataPoint copies metric m with only its d-th data point into dst, with
+// the point's and its exemplars' attributes in key order.
+func copyDataPoint(m pmetric.Metric, d int, dst pmetric.Metric) {
+	dst.SetName(m.Name())
+	dst.SetDescription(m.Description())
+	dst.SetUnit(m.Unit())
+	m.Metadata().CopyTo(dst.Metadata())
+	sortAttributes(dst.Metadata())
+	switch m.Type() {
+	case pmetric.MetricTypeGauge:
+		dp := dst.SetEmptyGauge().DataPoints().AppendEmpty()
+		m.Gauge().DataPoints().At(d).CopyTo(dp)
+		sortPointAttributes(dp.Attributes(), dp.Exemplars())
+	case pmetric.MetricTypeSum:
+		sum := dst.SetEmptySum()
+		sum.SetAggregationTemporality(m.Sum().AggregationTemporality())
+		sum.SetIsMonotonic(m.Sum().IsMonotonic())
+		dp := sum.DataPoints().AppendEmpty()
+		m.Sum().DataPoints().At(d).CopyTo(dp)
+		sortPointAttributes(dp.Attributes(), dp.Exemplars())
+	case pmetric.MetricTypeHistogram:
+		h := dst.SetEmptyHistogram()
+		h.SetAggregationTemporality(m.Histogram().AggregationTemporality())
+		dp := h.DataPoints().AppendEmpty()
+		m.Histogram().DataPoints().At(d).CopyTo(dp)
+		sortPointAttributes(dp.Attributes(), dp.Exemplars())
+	case pmetric.MetricTypeExponentialHistogram:
+		h := dst.SetEmptyExponentialHistogram()
+		h.SetAggregationTemporality(m.ExponentialHistogram().AggregationTemporality())
+		dp := h.DataPoints().AppendEmpty()
+		m.ExponentialHistogram().DataPoints().At(d).CopyTo(dp)
+		sortPointAttributes(dp.Attributes(), dp.Exemplars())
+	case pmetric.MetricTypeSummary:
+		dp := dst.SetEmptySummary().DataPoints().AppendEmpty()
+		m.Summary().DataPoints().At(d).CopyTo(dp)
+		sortAttributes(dp.Attributes())
+	}
+}
+
+func sortPointAttributes(attrs pcommon.Map, exemplars pmetric.ExemplarSlice) {
+	sortAttributes(attrs)
+	for i := 0; i < exemplars.Len(); i++ {
+		sortAttributes(exemplars.At(i).FilteredAttributes())
+	}
+}
+
+// sortAttributes puts m, and any maps nested in it, in key order, so that
+// equal maps encode to the same bytes.
+func sortAttributes(m pcommon.Map) {
+	keys := make([]string, 0, m.Len())
+	for k := range m.All() {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	sorted := pcommon.NewMap()
+	sorted.EnsureCapacity(len(keys))
+	for _, k := range keys {
+		v, _ := m.Get(k)
+		dst := sorted.PutEmpty(k)
+		v.CopyTo(dst)
+		if dst.Type() == pcommon.ValueTypeMap {
+			sortAttributes(dst.Map())
+		}
+	}
+	sorted.MoveTo(m)
+}
+
+// diffItems describes how a received item differs from the sent one it
+// resembles most.
+func diffItems(want, got payload) string {
+	wc, gc := countFidelity(want), countFidelity(got)
+	if wc != gc {
+		return fmt.Sprintf("counts differ: want %+v, got %+v", wc, gc)
+	}
+	if want.signal == signalMetrics {
+		wrm := want.metrics.Metrics().ResourceMetrics().At(0)
+		grm := got.metrics.Metrics().ResourceMetrics().At(0)
+		if !attrsEqual(wrm.Resource().Attributes(), grm.Resource().Attributes()) {
+			return "resource attributes differ"
+		}
+		if d := diffMetric(wrm.ScopeMetrics().At(0).Metrics().At(0), grm.ScopeMetrics().At(0).Metrics().At(0)); d != "" {
+			return d
+		}
+	}
+	return "encoded items differ"
+}
+
+// verifyFormat exports the dataset once with capturing enabled and checks
+// what the server decoded against it. Export returns only once every item
+// was delivered, queued exporters included, as it waits for the queue to
+// drain, and the servers capture a request before they respond to it.
+func verifyFormat(f benchFormat, export func([]payload) error, payloads []payload) (verification, error) {
+	f.capture.start()
+	if err := export(payloads); err != nil {
+		f.capture.stop()
+		return verification{}, err
+	}
+	received, _ := f.capture.stop()
+
+	if f.regroups {
+		return verifyItems(payloads, received)
+	}
+	return verifyPayloads(payloads, received), nil
+}
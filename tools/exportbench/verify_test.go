@@ -0,0 +1,178 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+)
+
+func TestVerifyPayloads(t *testing.T) {
+	cfg := defaultSyntheticConfig()
+	cfg.files = 3
+	sent, _, err := generatePayloads(cfg, signalMetrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// roundTrip re-decodes a payload, as a server would.
+	roundTrip := func(p payload) payload {
+		got, err := unmarshalPayload(p.signal, "", p.raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	t.Run("intact", func(t *testing.T) {
+		// Concurrent exporters may deliver out of order.
+		received := []payload{roundTrip(sent[2]), roundTrip(sent[0]), roundTrip(sent[1])}
+		v := verifyPayloads(sent, received)
+		if !v.ok() {
+			t.Fatalf("verification failed: %+v", v)
+		}
+	})
+
+	t.Run("lost attribute", func(t *testing.T) {
+		damaged := roundTrip(sent[1])
+		metric := damaged.metrics.Metrics().ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics().At(0)
+		if metric.Type() != pmetric.MetricTypeSum {
+			t.Fatalf("first synthetic metric is %s, want sum", metric.Type())
+		}
+		attrs := metric.Sum().DataPoints().At(0).Attributes()
+		var removed bool
+		attrs.RemoveIf(func(string, pcommon.Value) bool {
+			if removed {
+				return false
+			}
+			removed = true
+			return true
+		})
+
+		v := verifyPayloads(sent, []payload{roundTrip(sent[0]), damaged, roundTrip(sent[2])})
+		if v.ok() {
+			t.Fatal("verification passed with a dropped attribute")
+		}
+		if got := v.lost(); got.Attributes != 1 || got.Items != 0 {
+			t.Errorf("lost = %+v, want one attribute", got)
+		}
+		if v.Mismatched != 1 {
+			t.Errorf("mismatched = %d, want 1", v.Mismatched)
+		}
+		if !strings.Contains(v.FirstDiff, "attributes") {
+			t.Errorf("first diff %q does not mention attributes", v.FirstDiff)
+		}
+	})
+
+	t.Run("lost request", func(t *testing.T) {
+		v := verifyPayloads(sent, []payload{roundTrip(sent[0]), roundTrip(sent[2])})
+		if got, want := v.lost().Items, int64(sent[1].itemCount()); got != want {
+			t.Errorf("lost items = %d, want %d", got, want)
+		}
+		if !strings.Contains(v.FirstDiff, "never received") {
+			t.Errorf("first diff = %q", v.FirstDiff)
+		}
+	})
+}
+
+func TestCountFidelityExemplars(t *testing.T) {
+	req := pmetricotlp.NewExportRequest()
+	dp := req.Metrics().ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().
+		Metrics().AppendEmpty().SetEmptyHistogram().DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("k", "v")
+	dp.Exemplars().AppendEmpty()
+	dp.Exemplars().AppendEmpty()
+
+	got := countFidelity(payload{signal: signalMetrics, metrics: req})
+	want := fidelityCounts{Items: 1, Attributes: 1, Exemplars: 2}
+	if got != want {
+		t.Errorf("countFidelity = %+v, want %+v", got, want)
+	}
+}
+
+func TestVerifyItems(t *testing.T) {
+	cfg := defaultSyntheticConfig()
+	cfg.files = 3
+	sent, _, err := generatePayloads(cfg, signalMetrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// regroup merges the payloads into one request, as OTel Arrow and STEF
+	// may, with resources and their attributes in reverse order.
+	regroup := func() pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		for i := len(sent) - 1; i >= 0; i-- {
+			rms := sent[i].metrics.Metrics().ResourceMetrics()
+			for j := rms.Len() - 1; j >= 0; j-- {
+				rm := md.ResourceMetrics().AppendEmpty()
+				rms.At(j).CopyTo(rm)
+				attrs := rm.Resource().Attributes()
+				raw := attrs.AsRaw()
+				keys := make([]string, 0, len(raw))
+				for k := range attrs.All() {
+					keys = append(keys, k)
+				}
+				attrs.Clear()
+				for k := len(keys) - 1; k >= 0; k-- {
+					if err := attrs.PutEmpty(keys[k]).FromRaw(raw[keys[k]]); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+		}
+		return md
+	}
+
+	t.Run("regrouped", func(t *testing.T) {
+		received := payload{signal: signalMetrics, metrics: pmetricotlp.NewExportRequestFromMetrics(regroup())}
+		if v := verifyPayloads(sent, []payload{received}); v.ok() {
+			t.Fatal("request matching passed a regrouped request")
+		}
+		v, err := verifyItems(sent, []payload{received})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !v.ok() {
+			t.Fatalf("verification failed: %+v", v)
+		}
+	})
+
+	t.Run("changed value", func(t *testing.T) {
+		md := regroup()
+		metric := md.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics().At(0)
+		if metric.Type() != pmetric.MetricTypeSum {
+			t.Fatalf("first synthetic metric is %s, want sum", metric.Type())
+		}
+		dp := metric.Sum().DataPoints().At(0)
+		dp.SetDoubleValue(dp.DoubleValue() + 1)
+
+		v, err := verifyItems(sent, []payload{{signal: signalMetrics, metrics: pmetricotlp.NewExportRequestFromMetrics(md)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.ok() {
+			t.Fatal("verification passed with a changed value")
+		}
+		if v.Mismatched != 1 {
+			t.Errorf("mismatched = %d, want 1", v.Mismatched)
+		}
+		if !strings.Contains(v.FirstDiff, "values differ") {
+			t.Errorf("first diff = %q", v.FirstDiff)
+		}
+	})
+	t.Run("lost request", func(t *testing.T) {
+		v, err := verifyItems(sent, sent[:2])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := v.Mismatched, sent[2].itemCount(); got != want {
+			t.Errorf("mismatched = %d, want %d", got, want)
+		}
+		if !strings.HasPrefix(v.FirstDiff, sent[2].filename+": ") || !strings.Contains(v.FirstDiff, "never received") {
+			t.Errorf("first diff = %q", v.FirstDiff)
+		}
+	})
+}